@@ -0,0 +1,70 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+//go:build linux
+// +build linux
+
+// hy-simulator serves a simulated Huanyang VFD on a pseudo-terminal, e.g.
+// for running tinyg-control without an inverter:
+//
+//	hy-simulator -link=/tmp/ttyVfd &
+//	tinyg-control -port=/tmp/ttyVfd
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle/hysim"
+	"os"
+)
+
+func main() {
+	address := flag.Uint("address", 1, "Modbus address of the simulated VFD.")
+	acceleration := flag.Float64("acceleration", 100, "Acceleration in Hz per second.")
+	rpmPerHz := flag.Float64("rpm-per-hz", 60, "Spindle RPM per Hz of output frequency.")
+	link := flag.String("link", "", "Optional symbolic link to the pseudo-terminal, e.g. /tmp/ttyVfd.")
+	flag.Parse()
+
+	master, slavePath, err := hysim.OpenPty()
+	if err != nil {
+		fmt.Println("Could not open pseudo-terminal.")
+		panic(err)
+	}
+	defer master.Close()
+	// Keep the slave open, otherwise the master reports a hangup as soon
+	// as the first client closes the port.
+	slave, err := os.OpenFile(slavePath, os.O_RDWR, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer slave.Close()
+	if len(*link) > 0 {
+		os.Remove(*link)
+		if err = os.Symlink(slavePath, *link); err != nil {
+			panic(err)
+		}
+		defer os.Remove(*link)
+	}
+	fmt.Println("Simulated VFD listening on", slavePath)
+
+	vfd := hysim.NewSimulator()
+	vfd.Address = byte(*address)
+	vfd.Acceleration = *acceleration
+	vfd.RpmPerHz = *rpmPerHz
+	if err = vfd.Serve(master); err != nil {
+		fmt.Println(err)
+	}
+}
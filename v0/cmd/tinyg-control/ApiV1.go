@@ -0,0 +1,776 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// apiV1Prefix is the base path of the versioned API.
+const apiV1Prefix string = "/api/v1"
+
+// maxBodySize limits request bodies, programs are sent as JSON.
+const maxBodySize int64 = 32 << 20
+
+//go:embed openapi.yaml
+var openApiSpec []byte
+
+var (
+	errNoHeightMap = errors.New("no height map probed or loaded")
+)
+
+// TApiError is the error body of the versioned API. TinyG status codes
+// are included for errors reported by TinyG.
+type TApiError struct {
+	Status          int    `json:"status"`
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	TinygStatus     *int   `json:"tinygStatus,omitempty"`
+	TinygStatusName string `json:"tinygStatusName,omitempty"`
+}
+
+func (e *TApiError) Error() string {
+	return e.Message
+}
+
+// badRequest returns a 400 error for invalid request parameters.
+func badRequest(msg string) *TApiError {
+	return &TApiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: msg}
+}
+
+// apiErrors maps the errors of the controller to status codes. Wrapped
+// errors are matched with errors.Is.
+var apiErrors = []struct {
+	Err error
+	TApiError
+}{
+	{errNoHeightMap, TApiError{Status: http.StatusConflict, Code: "no_height_map"}},
+	{ErrInvalidFileName, TApiError{Status: http.StatusBadRequest, Code: "invalid_file_name"}},
+	{ErrNoSuchFile, TApiError{Status: http.StatusNotFound, Code: "no_such_file"}},
+	{ErrFileExists, TApiError{Status: http.StatusConflict, Code: "file_exists"}},
+	{tinyg.ErrJobRunning, TApiError{Status: http.StatusConflict, Code: "job_running"}},
+	{tinyg.ErrEmptyConsoleLine, TApiError{Status: http.StatusBadRequest, Code: "empty_command"}},
+	{tinyg.ErrNotHomed, TApiError{Status: http.StatusConflict, Code: "not_homed"}},
+	{tinyg.ErrAlarmNotAcknowledged, TApiError{Status: http.StatusConflict, Code: "alarm_not_acknowledged"}},
+	{tinyg.ErrNoToolChangePending, TApiError{Status: http.StatusConflict, Code: "no_tool_change_pending"}},
+	{tinyg.ErrMachinePositionUnset, TApiError{Status: http.StatusConflict, Code: "position_unknown"}},
+	{tinyg.ErrPositionNotReported, TApiError{Status: http.StatusConflict, Code: "position_not_reported"}},
+	{tinyg.ErrNoToolTable, TApiError{Status: http.StatusConflict, Code: "no_tool_table"}},
+	{tinyg.ErrNoSuchAlarm, TApiError{Status: http.StatusNotFound, Code: "no_such_alarm"}},
+	{tinyg.ErrNoSuchPosition, TApiError{Status: http.StatusNotFound, Code: "no_such_position"}},
+	{tinyg.ErrNoSuchTool, TApiError{Status: http.StatusNotFound, Code: "no_such_tool"}},
+	{tinyg.ErrPositionReadOnly, TApiError{Status: http.StatusForbidden, Code: "position_read_only"}},
+	{tinyg.ErrInvalidAxis, TApiError{Status: http.StatusBadRequest, Code: "invalid_axis"}},
+	{tinyg.ErrInvalidFeed, TApiError{Status: http.StatusBadRequest, Code: "invalid_feed"}},
+	{tinyg.ErrInvalidProbeDistance, TApiError{Status: http.StatusBadRequest, Code: "invalid_distance"}},
+	{tinyg.ErrInvalidOverride, TApiError{Status: http.StatusBadRequest, Code: "invalid_override"}},
+	{tinyg.ErrInvalidPositionName, TApiError{Status: http.StatusBadRequest, Code: "invalid_position_name"}},
+	{tinyg.ErrInvalidToolNumber, TApiError{Status: http.StatusBadRequest, Code: "invalid_tool_number"}},
+	{tinyg.ErrInvalidCoordinateSystem, TApiError{Status: http.StatusBadRequest, Code: "invalid_coordinate_system"}},
+	{tinyg.ErrInvalidGrid, TApiError{Status: http.StatusBadRequest, Code: "invalid_grid"}},
+	{tinyg.ErrOutsideEnvelope, TApiError{Status: http.StatusUnprocessableEntity, Code: "outside_envelope"}},
+	{tinyg.ErrLevelingArc, TApiError{Status: http.StatusUnprocessableEntity, Code: "leveling_failed"}},
+	{tinyg.ErrOffsetVerification, TApiError{Status: http.StatusBadGateway, Code: "offset_verification"}},
+	{tinyg.ErrOffsetNotReported, TApiError{Status: http.StatusGatewayTimeout, Code: "offset_timeout"}},
+	{tinyg.ErrHomingTimeout, TApiError{Status: http.StatusGatewayTimeout, Code: "homing_timeout"}},
+}
+
+// apiErrorFrom converts any error to an API error.
+func apiErrorFrom(err error) *TApiError {
+	var apiErr *TApiError
+	var homingErr *tinyg.HomingError
+	var probeErr *tinyg.ProbeError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &homingErr):
+		return tinygError(http.StatusUnprocessableEntity, "homing_failed", err.Error(), homingErr.Status)
+	case errors.As(err, &probeErr):
+		code := http.StatusUnprocessableEntity
+		if probeErr.Failure == tinyg.ProbeTimeout {
+			code = http.StatusGatewayTimeout
+		}
+		if probeErr.Failure == tinyg.ProbeAlarm {
+			return tinygError(code, "probe_failed", err.Error(), probeErr.Status)
+		}
+		return &TApiError{Status: code, Code: "probe_failed", Message: err.Error()}
+	}
+	for _, known := range apiErrors {
+		if errors.Is(err, known.Err) {
+			mapped := known.TApiError
+			mapped.Message = err.Error()
+			return &mapped
+		}
+	}
+	return &TApiError{Status: http.StatusInternalServerError, Code: "internal", Message: err.Error()}
+}
+
+func tinygError(status int, code, msg string, tinygStatus tgjson.TResponseStatusCode) *TApiError {
+	value := int(tinygStatus)
+	return &TApiError{Status: status, Code: code, Message: msg,
+		TinygStatus: &value, TinygStatusName: tinygStatus.String()}
+}
+
+// tApiHandler handles a request of the versioned API. A nil result is
+// answered with 204 No Content, tApiStatus selects another status code.
+type tApiHandler func(req *http.Request) (interface{}, error)
+
+// tApiStatus is a result with a status code other than 200.
+type tApiStatus struct {
+	Status int
+	Body   interface{}
+}
+
+// tApiRaw is a result which is not encoded as JSON.
+type tApiRaw struct {
+	ContentType string
+	Data        []byte
+	Filename    string // offered as download if set
+}
+
+// tApiStream is a result which writes the response itself, e.g. events.
+type tApiStream func(w http.ResponseWriter, req *http.Request)
+
+// tApiCookie is a result which sets a cookie. A nil body is answered
+// with 204 No Content.
+type tApiCookie struct {
+	Cookie *http.Cookie
+	Body   interface{}
+}
+
+// tApiRoute is an endpoint of the versioned API. The route table is used
+// for registering the handlers and for checking the OpenAPI spec.
+type tApiRoute struct {
+	Method  string
+	Path    string
+	Handler tApiHandler
+}
+
+func apiV1Routes() []tApiRoute {
+	return []tApiRoute{
+		{"GET", "/openapi.yaml", apiV1OpenApi},
+		{"POST", "/login", apiV1Login},
+		{"POST", "/logout", apiV1Logout},
+		{"GET", "/whoami", apiV1WhoAmI},
+		{"GET", "/control", apiV1Control},
+		{"POST", "/control/acquire", apiV1ControlAcquire},
+		{"POST", "/control/release", apiV1ControlRelease},
+		{"GET", "/events", apiV1Events},
+		{"GET", "/state", apiV1State},
+		{"POST", "/gcode", apiV1Gcode},
+		{"POST", "/program", apiV1Program},
+		{"GET", "/job", apiV1Job},
+		{"GET", "/jobs/history", apiV1JobsHistory},
+		{"GET", "/console", apiV1Console},
+		{"POST", "/console", apiV1ConsoleSend},
+		{"GET", "/console/stream", apiV1ConsoleStream},
+		{"GET", "/console/history", apiV1ConsoleHistory},
+		{"GET", "/files", apiV1Files},
+		{"POST", "/files", apiV1FilesUpload},
+		{"DELETE", "/files", apiV1FilesDelete},
+		{"GET", "/files/content", apiV1FilesContent},
+		{"POST", "/files/rename", apiV1FilesRename},
+		{"POST", "/files/run", apiV1FilesRun},
+		{"POST", "/feedhold", apiV1FeedHold},
+		{"POST", "/resume", apiV1Resume},
+		{"POST", "/flush", apiV1Flush},
+		{"POST", "/reset", apiV1Reset},
+		{"POST", "/exit", apiV1Exit},
+		{"GET", "/spindle", apiV1Spindle},
+		{"GET", "/overrides", apiV1Overrides},
+		{"PATCH", "/overrides", apiV1OverridesPatch},
+		{"GET", "/alarms", apiV1Alarms},
+		{"POST", "/alarms/ack", apiV1AlarmsAck},
+		{"POST", "/alarms/clear", apiV1AlarmsClear},
+		{"POST", "/jog", apiV1Jog},
+		{"POST", "/jog/start", apiV1JogStart},
+		{"POST", "/jog/stop", apiV1JogStop},
+		{"POST", "/home", apiV1Home},
+		{"GET", "/homed", apiV1Homed},
+		{"POST", "/probe", apiV1Probe},
+		{"GET", "/wcs", apiV1Wcs},
+		{"PUT", "/wcs/offset", apiV1WcsOffset},
+		{"POST", "/wcs/zero", apiV1WcsZero},
+		{"POST", "/wcs/select", apiV1WcsSelect},
+		{"GET", "/positions", apiV1Positions},
+		{"POST", "/positions", apiV1PositionsSave},
+		{"DELETE", "/positions", apiV1PositionsDelete},
+		{"POST", "/positions/goto", apiV1PositionsGoto},
+		{"GET", "/toolchange", apiV1ToolChange},
+		{"POST", "/toolchange/confirm", apiV1ToolChangeConfirm},
+		{"POST", "/toolchange/cancel", apiV1ToolChangeCancel},
+		{"GET", "/tools", apiV1Tools},
+		{"PUT", "/tools", apiV1ToolsSet},
+		{"DELETE", "/tools", apiV1ToolsDelete},
+		{"POST", "/tools/select", apiV1ToolsSelect},
+		{"GET", "/heightmap", apiV1HeightMap},
+		{"POST", "/heightmap/probe", apiV1HeightMapProbe},
+		{"PUT", "/heightmap/enabled", apiV1HeightMapEnable},
+		{"POST", "/heightmap/save", apiV1HeightMapSave},
+		{"POST", "/heightmap/load", apiV1HeightMapLoad},
+	}
+}
+
+// registerApiV1 registers all routes. Requests with other methods are
+// answered with 405 and the allowed methods.
+func registerApiV1(mux *http.ServeMux) {
+	var paths []string
+	byPath := make(map[string][]tApiRoute)
+	for _, route := range apiV1Routes() {
+		if _, ok := byPath[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path] = append(byPath[route.Path], route)
+	}
+	for _, path := range paths {
+		routes := byPath[path]
+		mux.HandleFunc(apiV1Prefix+path, func(w http.ResponseWriter, req *http.Request) {
+			var allowed []string
+			for _, route := range routes {
+				if route.Method == req.Method {
+					serveApiV1(w, req, route.Handler)
+					return
+				}
+				allowed = append(allowed, route.Method)
+			}
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeApiV1(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": &TApiError{
+				Status: http.StatusMethodNotAllowed, Code: "method_not_allowed",
+				Message: "use " + strings.Join(allowed, ", ")}})
+		})
+	}
+	// The unversioned endpoints of earlier versions are answered like unknown ones.
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, req *http.Request) {
+		writeApiV1(w, http.StatusNotFound, map[string]interface{}{"error": &TApiError{
+			Status: http.StatusNotFound, Code: "not_found", Message: "no such endpoint, see " + apiV1Prefix + "/openapi.yaml"}})
+	})
+}
+
+func serveApiV1(w http.ResponseWriter, req *http.Request, handler tApiHandler) {
+	result, err := handler(req)
+	if err != nil {
+		apiErr := apiErrorFrom(err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			glog.Errorln(req.Method, " ", req.URL.Path, ": ", err)
+		}
+		writeApiV1(w, apiErr.Status, map[string]interface{}{"error": apiErr})
+		return
+	}
+	switch r := result.(type) {
+	case nil:
+		writeApiV1(w, http.StatusNoContent, nil)
+	case tApiStatus:
+		writeApiV1(w, r.Status, r.Body)
+	case tApiCookie:
+		http.SetCookie(w, r.Cookie)
+		if r.Body == nil {
+			writeApiV1(w, http.StatusNoContent, nil)
+		} else {
+			writeApiV1(w, http.StatusOK, r.Body)
+		}
+	case tApiStream:
+		r(w, req)
+	case tApiRaw:
+		w.Header().Set("Content-Type", r.ContentType)
+		if len(r.Filename) > 0 {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": r.Filename}))
+		}
+		w.Write(r.Data)
+	default:
+		writeApiV1(w, http.StatusOK, result)
+	}
+}
+
+func writeApiV1(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// decodeBody reads a JSON request body into v. Unknown fields are rejected.
+func decodeBody(req *http.Request, v interface{}) error {
+	if contentType := req.Header.Get("Content-Type"); len(contentType) > 0 &&
+		!strings.HasPrefix(contentType, "application/json") {
+		return &TApiError{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type",
+			Message: "request body has to be application/json"}
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, req.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &TApiError{Status: http.StatusBadRequest, Code: "invalid_body", Message: err.Error()}
+	}
+	return nil
+}
+
+// queryBool returns true for ?key=1 or ?key=true.
+func queryBool(req *http.Request, key string) bool {
+	value, _ := strconv.ParseBool(req.URL.Query().Get(key))
+	return value
+}
+
+func apiV1OpenApi(req *http.Request) (interface{}, error) {
+	return tApiRaw{ContentType: "application/yaml", Data: openApiSpec}, nil
+}
+
+func apiV1State(req *http.Request) (interface{}, error) {
+	return json.RawMessage(tgHandle.NamedStateJson()), nil
+}
+
+type tGcodeRequest struct {
+	Line string `json:"line"`
+}
+
+// apiV1Gcode sends a single line (MDI). It is refused while a job runs.
+func apiV1Gcode(req *http.Request) (interface{}, error) {
+	var body tGcodeRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if tgHandle.JobRunning() {
+		return nil, tinyg.ErrJobRunning
+	}
+	tgHandle.Write(body.Line)
+	return tApiStatus{Status: http.StatusAccepted}, nil
+}
+
+type tProgramRequest struct {
+	Name  string   `json:"name"`
+	Lines []string `json:"lines"`
+}
+
+// apiV1Program runs the lines of the body as job.
+func apiV1Program(req *http.Request) (interface{}, error) {
+	var body tProgramRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	job, err := tgHandle.RunJob(body.Name, body.Lines)
+	if err != nil {
+		return nil, err
+	}
+	return tApiStatus{Status: http.StatusAccepted, Body: job}, nil
+}
+
+func apiV1FeedHold(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.FeedHold()
+}
+
+func apiV1Resume(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.FeedResume()
+}
+
+func apiV1Flush(req *http.Request) (interface{}, error) {
+	tgHandle.Flush()
+	return nil, nil
+}
+
+func apiV1Reset(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.TinygReset()
+}
+
+// apiV1Exit stops the server, e.g. for restarting it after an update.
+func apiV1Exit(req *http.Request) (interface{}, error) {
+	return tApiStream(func(w http.ResponseWriter, req *http.Request) {
+		writeApiV1(w, http.StatusNoContent, nil)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		glog.Infoln("Exit requested by ", identityOf(req).Name)
+		glog.Flush()
+		os.Exit(0)
+	}), nil
+}
+
+func apiV1Spindle(req *http.Request) (interface{}, error) {
+	return spindleStatus(), nil
+}
+
+func apiV1Overrides(req *http.Request) (interface{}, error) {
+	return tgHandle.Overrides(), nil
+}
+
+type tOverridesRequest struct {
+	Feed     *float64 `json:"feed"`
+	Traverse *float64 `json:"traverse"`
+	Spindle  *float64 `json:"spindle"`
+}
+
+// apiV1OverridesPatch sets the given overrides and returns all overrides.
+func apiV1OverridesPatch(req *http.Request) (interface{}, error) {
+	var body tOverridesRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Feed != nil {
+		if err := tgHandle.SetFeedOverride(*body.Feed); err != nil {
+			return nil, err
+		}
+	}
+	if body.Traverse != nil {
+		if err := tgHandle.SetTraverseOverride(*body.Traverse); err != nil {
+			return nil, err
+		}
+	}
+	if body.Spindle != nil {
+		if err := tgHandle.SetSpindleOverride(*body.Spindle); err != nil {
+			return nil, err
+		}
+	}
+	return tgHandle.Overrides(), nil
+}
+
+func apiV1Alarms(req *http.Request) (interface{}, error) {
+	since, _ := strconv.Atoi(req.URL.Query().Get("since"))
+	return tgHandle.Alarms(since), nil
+}
+
+type tAlarmAckRequest struct {
+	Id int `json:"id"` // 0 acknowledges all alarms
+}
+
+func apiV1AlarmsAck(req *http.Request) (interface{}, error) {
+	var body tAlarmAckRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.AcknowledgeAlarm(body.Id)
+}
+
+func apiV1AlarmsClear(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.ClearAlarms()
+}
+
+type tJogRequest struct {
+	Axis      string  `json:"axis"`
+	Distance  float64 `json:"distance"`
+	Direction int     `json:"direction"`
+	Feed      float64 `json:"feed"`
+}
+
+func apiV1Jog(req *http.Request) (interface{}, error) {
+	var body tJogRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.Jog(body.Axis, body.Distance, body.Feed)
+}
+
+// apiV1JogStart starts or keeps alive a continuous jog.
+func apiV1JogStart(req *http.Request) (interface{}, error) {
+	var body tJogRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Direction == 0 {
+		return nil, badRequest("direction has to be 1 or -1")
+	}
+	return nil, tgHandle.JogStart(body.Axis, body.Direction, body.Feed)
+}
+
+func apiV1JogStop(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.JogStop()
+}
+
+type tHomeRequest struct {
+	Axes string `json:"axes"` // e.g. "XY", empty for XYZ
+}
+
+// apiV1Home runs the homing cycle and answers when it has finished.
+func apiV1Home(req *http.Request) (interface{}, error) {
+	var body tHomeRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := tgHandle.Home(strings.Split(body.Axes, "")...); err != nil {
+		return nil, err
+	}
+	return homedStatus(), nil
+}
+
+func apiV1Homed(req *http.Request) (interface{}, error) {
+	return homedStatus(), nil
+}
+
+type tProbeRequest struct {
+	Routine    string  `json:"routine"` // probe, z, edge, corner or center
+	Axis       string  `json:"axis"`
+	Direction  int     `json:"direction"`
+	XDirection int     `json:"xDirection"`
+	YDirection int     `json:"yDirection"`
+	Clearance  float64 `json:"clearance"`
+	SetZero    bool    `json:"setZero"`
+	tinyg.TProbeSettings
+}
+
+type tProbeResponse struct {
+	Routine string      `json:"routine"`
+	Result  interface{} `json:"result"`
+}
+
+func apiV1Probe(req *http.Request) (interface{}, error) {
+	var body tProbeRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	var result interface{}
+	var err error
+	switch body.Routine {
+	case "probe":
+		result, err = tgHandle.Probe(body.Axis, body.Direction, body.MaxDistance, body.Feed)
+	case "z":
+		result, err = tgHandle.ProbeZTouchOff(body.TProbeSettings)
+	case "edge":
+		result, err = tgHandle.FindEdge(body.Axis, body.Direction, body.TProbeSettings, body.SetZero)
+	case "corner":
+		result, err = tgHandle.FindCorner(body.XDirection, body.YDirection, body.Clearance, body.TProbeSettings, body.SetZero)
+	case "center":
+		result, err = tgHandle.FindCenter(body.TProbeSettings, body.SetZero)
+	default:
+		return nil, badRequest("unknown routine " + strconv.Quote(body.Routine))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tProbeResponse{Routine: body.Routine, Result: result}, nil
+}
+
+// apiV1Wcs lists all work offsets, ?refresh=true requests them from TinyG first.
+func apiV1Wcs(req *http.Request) (interface{}, error) {
+	if queryBool(req, "refresh") {
+		if err := tgHandle.RefreshOffsets(); err != nil {
+			return nil, err
+		}
+	}
+	return tgHandle.WorkOffsets(), nil
+}
+
+type tWcsOffsetRequest struct {
+	Cs   tgjson.TCoordinateSystem `json:"cs"`
+	Axes map[string]float64       `json:"axes"`
+}
+
+func apiV1WcsOffset(req *http.Request) (interface{}, error) {
+	var body tWcsOffsetRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.SetWorkOffset(body.Cs, body.Axes)
+}
+
+type tWcsZeroRequest struct {
+	Axis string `json:"axis"`
+}
+
+func apiV1WcsZero(req *http.Request) (interface{}, error) {
+	var body tWcsZeroRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.ZeroAxis(body.Axis)
+}
+
+type tWcsSelectRequest struct {
+	Cs tgjson.TCoordinateSystem `json:"cs"`
+}
+
+func apiV1WcsSelect(req *http.Request) (interface{}, error) {
+	var body tWcsSelectRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.SelectCoordinateSystem(body.Cs)
+}
+
+// apiV1Positions lists all named positions, ?refresh=true requests G28 and G30 first.
+func apiV1Positions(req *http.Request) (interface{}, error) {
+	if queryBool(req, "refresh") {
+		if err := tgHandle.RefreshSavedPositions(); err != nil {
+			return nil, err
+		}
+	}
+	return tgHandle.SavedPositions(), nil
+}
+
+type tPositionRequest struct {
+	Name string `json:"name"`
+}
+
+// apiV1PositionsSave stores the current machine position.
+func apiV1PositionsSave(req *http.Request) (interface{}, error) {
+	var body tPositionRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := tgHandle.SaveCurrentPosition(body.Name); err != nil {
+		return nil, err
+	}
+	pos, _ := tgHandle.Positions.Get(body.Name)
+	return tApiStatus{Status: http.StatusCreated, Body: pos}, nil
+}
+
+func apiV1PositionsDelete(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.Positions.Delete(req.URL.Query().Get("name"))
+}
+
+func apiV1PositionsGoto(req *http.Request) (interface{}, error) {
+	var body tPositionRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, tgHandle.MoveToSavedPosition(body.Name, safeZ)
+}
+
+func apiV1ToolChange(req *http.Request) (interface{}, error) {
+	return tgHandle.ToolChangeState(), nil
+}
+
+func apiV1ToolChangeConfirm(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.ConfirmToolChange()
+}
+
+func apiV1ToolChangeCancel(req *http.Request) (interface{}, error) {
+	return nil, tgHandle.CancelToolChange()
+}
+
+func apiV1Tools(req *http.Request) (interface{}, error) {
+	return toolsStatus(), nil
+}
+
+// apiV1ToolsSet adds or replaces a tool.
+func apiV1ToolsSet(req *http.Request) (interface{}, error) {
+	var body tinyg.TTool
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := tgHandle.Tools.Set(body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func apiV1ToolsDelete(req *http.Request) (interface{}, error) {
+	number, err := strconv.Atoi(req.URL.Query().Get("number"))
+	if err != nil {
+		return nil, tinyg.ErrInvalidToolNumber
+	}
+	return nil, tgHandle.Tools.Delete(number)
+}
+
+type tToolSelectRequest struct {
+	Number int `json:"number"` // 0 removes the length compensation
+}
+
+func apiV1ToolsSelect(req *http.Request) (interface{}, error) {
+	var body tToolSelectRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := tgHandle.SelectTool(body.Number); err != nil {
+		return nil, err
+	}
+	return toolsStatus(), nil
+}
+
+func apiV1HeightMap(req *http.Request) (interface{}, error) {
+	return heightMapStatus(), nil
+}
+
+type tHeightMapProbeRequest struct {
+	X0        float64 `json:"x0"`
+	Y0        float64 `json:"y0"`
+	X1        float64 `json:"x1"`
+	Y1        float64 `json:"y1"`
+	Cols      int     `json:"cols"`
+	Rows      int     `json:"rows"`
+	Clearance float64 `json:"clearance"`
+	tinyg.TProbeSettings
+}
+
+func apiV1HeightMapProbe(req *http.Request) (interface{}, error) {
+	var body tHeightMapProbeRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	heightMap, err := tgHandle.ProbeHeightMap(body.X0, body.Y0, body.X1, body.Y1,
+		body.Cols, body.Rows, body.Clearance, body.TProbeSettings)
+	if err != nil {
+		return nil, err
+	}
+	setCurrentHeightMap(heightMap)
+	return heightMap, nil
+}
+
+type tHeightMapEnableRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+func apiV1HeightMapEnable(req *http.Request) (interface{}, error) {
+	var body tHeightMapEnableRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := enableHeightMap(body.Enabled); err != nil {
+		return nil, err
+	}
+	return heightMapStatus(), nil
+}
+
+type tHeightMapNameRequest struct {
+	Name string `json:"name"`
+}
+
+func apiV1HeightMapSave(req *http.Request) (interface{}, error) {
+	var body tHeightMapNameRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	return nil, saveHeightMap(body.Name)
+}
+
+func apiV1HeightMapLoad(req *http.Request) (interface{}, error) {
+	var body tHeightMapNameRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	heightMap, err := tinyg.LoadHeightMap(heightMapPath(body.Name))
+	if err != nil {
+		return nil, &TApiError{Status: http.StatusNotFound, Code: "no_such_height_map", Message: err.Error()}
+	}
+	setCurrentHeightMap(heightMap)
+	return heightMap, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenApiSpec checks that the spec documents exactly the registered routes.
+func TestOpenApiSpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openApiSpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	documented := make(map[string]bool)
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			if method != "parameters" {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	for _, route := range apiV1Routes() {
+		key := route.Method + " " + route.Path
+		if !documented[key] {
+			t.Error("Route not documented: ", key)
+		}
+		delete(documented, key)
+	}
+	for key := range documented {
+		t.Error("Documented route not registered: ", key)
+	}
+}
+
+func TestApiV1Errors(t *testing.T) {
+	mux := http.NewServeMux()
+	registerApiV1(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/v1/overrides", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, PATCH" {
+		t.Error("Wrong answer for unknown method: ", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/gcode", strings.NewReader(`{"cmd":"G0"}`)))
+	var body struct {
+		Error TApiError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusBadRequest || body.Error.Code != "invalid_body" {
+		t.Error("Unknown field not rejected: ", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/nothing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("Unknown endpoint: ", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/halt", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"not_found"`) {
+		t.Error("Unversioned endpoint still answered: ", rec.Code, rec.Body.String())
+	}
+
+	if apiErr := apiErrorFrom(tinyg.ErrJobRunning); apiErr.Status != http.StatusConflict || apiErr.Message != tinyg.ErrJobRunning.Error() {
+		t.Error("Wrong mapping: ", apiErr)
+	}
+	tg, _ := tinyg.NewController()
+	tg.RequireHomed = "XY"
+	rec = httptest.NewRecorder()
+	serveApiV1(rec, httptest.NewRequest("POST", "/api/v1/program", nil), func(req *http.Request) (interface{}, error) {
+		return nil, tg.CheckHomed()
+	})
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusConflict || body.Error.Code != "not_homed" {
+		t.Error("Wrapped sentinel not mapped: ", rec.Code, rec.Body.String())
+	}
+	if apiErr := apiErrorFrom(fmt.Errorf("job: %w", ErrNoSuchFile)); apiErr.Status != http.StatusNotFound || apiErr.Code != "no_such_file" {
+		t.Error("Wrong mapping of wrapped error: ", apiErr)
+	}
+	probeErr := &tinyg.ProbeError{Failure: tinyg.ProbeAlarm, Status: 251, Message: "alarm"}
+	if apiErr := apiErrorFrom(probeErr); apiErr.TinygStatus == nil || *apiErr.TinygStatus != 251 || len(apiErr.TinygStatusName) == 0 {
+		t.Error("TinyG status missing: ", apiErr)
+	}
+}
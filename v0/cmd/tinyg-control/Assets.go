@@ -0,0 +1,47 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// staticFiles holds the web interface. Only the parts of the jQuery and
+// IBM Plex packages which are used by the pages are embedded.
+//
+//go:embed static/*.html static/*.js static/*.css
+//go:embed static/node_modules/jquery/dist/jquery.min.js
+//go:embed static/plexfont/css
+//go:embed static/plexfont/IBM-Plex-Mono/fonts
+//go:embed static/plexfont/IBM-Plex-Sans/fonts
+//go:embed static/plexfont/IBM-Plex-Sans-Condensed/fonts
+var staticFiles embed.FS
+
+// staticFileSystem returns the embedded web interface, or dir if set,
+// which allows to edit the interface without rebuilding.
+func staticFileSystem(dir string) http.FileSystem {
+	if len(dir) > 0 {
+		return http.Dir(dir)
+	}
+	files, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(files)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbeddedAssets(t *testing.T) {
+	server := http.FileServer(staticFileSystem(""))
+	for _, path := range []string{"/", "/style.css", "/node_modules/jquery/dist/jquery.min.js", "/plexfont/css/ibm-plex.min.css"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Error(path, ": ", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TRole is the access level of a user. Higher roles include the lower ones.
+type TRole int
+
+const (
+	RoleNone     TRole = 0
+	RoleViewer   TRole = 1 // machine state only
+	RoleOperator TRole = 2 // run jobs, jog, probe
+	RoleAdmin    TRole = 3 // configuration, reset and exit
+)
+
+var roleNames = map[TRole]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (o TRole) String() string {
+	return roleNames[o]
+}
+
+func (o TRole) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *TRole) UnmarshalText(text []byte) error {
+	for role, name := range roleNames {
+		if role != RoleNone && name == string(text) {
+			*o = role
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", string(text))
+}
+
+// sessionCookie is the name of the cookie holding the session id.
+const sessionCookie string = "tinyg_session"
+
+// basicAuthCacheTime is the time a successful basic auth check is reused,
+// scripts would otherwise pay for bcrypt on every request.
+const basicAuthCacheTime time.Duration = time.Minute
+
+var errLoginFailed = errors.New("wrong user name or password")
+
+// TUsersFile is the format of the users file. Passwords are stored as
+// bcrypt hashes and tokens as hex encoded SHA-256 hashes, both can be
+// created with -hash-password and -new-token.
+type TUsersFile struct {
+	Users  []TUser  `yaml:"users"`
+	Tokens []TToken `yaml:"tokens"`
+}
+
+type TUser struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+type TToken struct {
+	Name   string `yaml:"name"`
+	Sha256 string `yaml:"sha256"`
+	Role   string `yaml:"role"`
+}
+
+// TIdentity is the authenticated user of a request.
+type TIdentity struct {
+	Name string `json:"name"`
+	Role TRole  `json:"role"`
+}
+
+type tAccount struct {
+	hash []byte
+	role TRole
+}
+
+type tSession struct {
+	identity TIdentity
+	expires  time.Time
+}
+
+// TAuth authenticates requests by session cookie, bearer token or basic auth.
+type TAuth struct {
+	SessionTimeout time.Duration
+
+	users    map[string]tAccount
+	tokens   map[string]TIdentity // by SHA-256 of the token
+	lock     sync.Mutex
+	sessions map[string]*tSession
+	basic    map[string]*tSession // checked credentials by cacheKey
+	basicKey []byte               // random HMAC key of the credentials cache
+}
+
+// LoadAuth reads the users file.
+func LoadAuth(path string, sessionTimeout time.Duration) (*TAuth, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file TUsersFile
+	if err = yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	o := &TAuth{
+		SessionTimeout: sessionTimeout,
+		users:          make(map[string]tAccount),
+		tokens:         make(map[string]TIdentity),
+		sessions:       make(map[string]*tSession),
+		basic:          make(map[string]*tSession),
+		basicKey:       make([]byte, 32),
+	}
+	if _, err = rand.Read(o.basicKey); err != nil {
+		return nil, err
+	}
+	for _, user := range file.Users {
+		var role TRole
+		if err = role.UnmarshalText([]byte(user.Role)); err != nil {
+			return nil, fmt.Errorf("%s: user %s: %v", path, user.Name, err)
+		}
+		if _, err = bcrypt.Cost([]byte(user.Password)); err != nil {
+			return nil, fmt.Errorf("%s: user %s: password is not a bcrypt hash", path, user.Name)
+		}
+		o.users[user.Name] = tAccount{hash: []byte(user.Password), role: role}
+	}
+	for _, token := range file.Tokens {
+		var role TRole
+		if err = role.UnmarshalText([]byte(token.Role)); err != nil {
+			return nil, fmt.Errorf("%s: token %s: %v", path, token.Name, err)
+		}
+		if hash, err := hex.DecodeString(token.Sha256); err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%s: token %s: sha256 is not a hex encoded SHA-256 hash", path, token.Name)
+		}
+		o.tokens[strings.ToLower(token.Sha256)] = TIdentity{Name: token.Name, Role: role}
+	}
+	if len(o.users) == 0 && len(o.tokens) == 0 {
+		return nil, fmt.Errorf("%s: no users or tokens", path)
+	}
+	return o, nil
+}
+
+// dummyHash is compared for unknown users, so that the answer time does
+// not reveal which users exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// checkPassword returns the identity of a user with a matching password.
+func (o *TAuth) checkPassword(name, password string) (TIdentity, error) {
+	account, ok := o.users[name]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return TIdentity{}, errLoginFailed
+	}
+	if bcrypt.CompareHashAndPassword(account.hash, []byte(password)) != nil {
+		return TIdentity{}, errLoginFailed
+	}
+	return TIdentity{Name: name, Role: account.role}, nil
+}
+
+// checkBasicAuth checks the credentials of a basic auth request. Successful
+// checks are cached by a keyed hash of the credentials.
+func (o *TAuth) checkBasicAuth(name, password string) (TIdentity, error) {
+	mac := hmac.New(sha256.New, o.basicKey)
+	mac.Write([]byte(name + "\x00" + password))
+	key := hex.EncodeToString(mac.Sum(nil))
+	o.lock.Lock()
+	cached, ok := o.basic[key]
+	o.lock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.identity, nil
+	}
+	identity, err := o.checkPassword(name, password)
+	if err != nil {
+		return identity, err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	now := time.Now()
+	for key, entry := range o.basic {
+		if now.After(entry.expires) {
+			delete(o.basic, key)
+		}
+	}
+	o.basic[key] = &tSession{identity: identity, expires: now.Add(basicAuthCacheTime)}
+	return identity, nil
+}
+
+// Login checks the password and creates a session.
+func (o *TAuth) Login(name, password string) (sessionId string, identity TIdentity, err error) {
+	if identity, err = o.checkPassword(name, password); err != nil {
+		return
+	}
+	if sessionId, err = randomHex(32); err != nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.removeExpired()
+	o.sessions[sessionId] = &tSession{identity: identity, expires: time.Now().Add(o.SessionTimeout)}
+	return
+}
+
+// Logout removes a session.
+func (o *TAuth) Logout(sessionId string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delete(o.sessions, sessionId)
+}
+
+func (o *TAuth) removeExpired() {
+	now := time.Now()
+	for id, session := range o.sessions {
+		if now.After(session.expires) {
+			delete(o.sessions, id)
+		}
+	}
+}
+
+// Identify authenticates a request. Sessions are extended on every use.
+func (o *TAuth) Identify(req *http.Request) (TIdentity, bool) {
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		sum := sha256.Sum256([]byte(strings.TrimPrefix(header, "Bearer ")))
+		identity, ok := o.tokens[hex.EncodeToString(sum[:])]
+		return identity, ok
+	}
+	if name, password, ok := req.BasicAuth(); ok {
+		identity, err := o.checkBasicAuth(name, password)
+		return identity, err == nil
+	}
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil {
+		return TIdentity{}, false
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	session, ok := o.sessions[cookie.Value]
+	if !ok || time.Now().After(session.expires) {
+		return TIdentity{}, false
+	}
+	session.expires = time.Now().Add(o.SessionTimeout)
+	return session.identity, true
+}
+
+type tIdentityKey struct{}
+
+// anonymousAdmin is the identity of all requests if authentication is disabled.
+var anonymousAdmin = TIdentity{Role: RoleAdmin}
+
+// identityOf returns the identity stored by the auth handler.
+func identityOf(req *http.Request) TIdentity {
+	if identity, ok := req.Context().Value(tIdentityKey{}).(TIdentity); ok {
+		return identity
+	}
+	return anonymousAdmin
+}
+
+// Handler checks the role required for a request before passing it on.
+// A nil TAuth allows everything.
+func (o *TAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if o == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		required := requiredRole(req)
+		identity, ok := o.Identify(req)
+		switch {
+		case required == RoleNone:
+		case !ok && !strings.HasPrefix(req.URL.Path, "/api/"):
+			http.Redirect(w, req, "/login.html", http.StatusFound)
+			return
+		case !ok:
+			writeAuthError(w, req, http.StatusUnauthorized, "unauthorized", "login required")
+			return
+		case identity.Role < required:
+			writeAuthError(w, req, http.StatusForbidden, "forbidden", "role "+required.String()+" required")
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tIdentityKey{}, identity)))
+	})
+}
+
+// writeAuthError answers with an error of the versioned API.
+func writeAuthError(w http.ResponseWriter, req *http.Request, status int, code, msg string) {
+	writeApiV1(w, status, map[string]interface{}{"error": &TApiError{Status: status, Code: code, Message: msg}})
+}
+
+// publicPaths can be accessed without login.
+var publicPaths = map[string]bool{
+	"/login.html":           true,
+	"/login.js":             true,
+	"/style.css":            true,
+	apiV1Prefix + "/login":  true,
+	apiV1Prefix + "/logout": true,
+	apiV1Prefix + "/whoami": true,
+	"/node_modules/jquery/dist/jquery.min.js": true,
+}
+
+// adminPaths change the configuration or the controller itself.
+var adminPaths = map[string]bool{
+	"DELETE " + apiV1Prefix + "/positions": true,
+	"POST " + apiV1Prefix + "/reset":       true,
+	"POST " + apiV1Prefix + "/exit":        true,
+	"PUT " + apiV1Prefix + "/tools":        true,
+	"DELETE " + apiV1Prefix + "/tools":     true,
+}
+
+// requiredRole returns the role needed for a request. The web interface
+// and reading state needs a viewer, all other API calls an operator.
+func requiredRole(req *http.Request) TRole {
+	path := req.URL.Path
+	switch {
+	case publicPaths[path] || strings.HasPrefix(path, "/plexfont/"):
+		return RoleNone
+	case adminPaths[path] || adminPaths[req.Method+" "+path]:
+		return RoleAdmin
+	case strings.HasPrefix(path, apiV1Prefix+"/"):
+		if req.Method == "GET" {
+			return RoleViewer
+		}
+		return RoleOperator
+	}
+	return RoleViewer
+}
+
+func randomHex(n int) (string, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// hashPassword reads a password line and prints its bcrypt hash for the users file.
+func hashPassword(in io.Reader, out io.Writer) error {
+	password, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) == 0 {
+		return errors.New("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(hash))
+	return nil
+}
+
+// newToken prints a random API token and the hash to put into the users file.
+func newToken(out io.Writer) error {
+	token, err := randomHex(24)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(token))
+	fmt.Fprintf(out, "token:  %s\nsha256: %s\n", token, hex.EncodeToString(sum[:]))
+	return nil
+}
+
+type tLoginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type tWhoAmIResponse struct {
+	AuthEnabled bool `json:"authEnabled"`
+	LoggedIn    bool `json:"loggedIn"`
+	TIdentity
+}
+
+var errAuthDisabled = &TApiError{Status: http.StatusNotFound, Code: "auth_disabled", Message: "authentication is disabled"}
+
+// apiV1Login checks the password and sets the session cookie.
+func apiV1Login(req *http.Request) (interface{}, error) {
+	if auth == nil {
+		return nil, errAuthDisabled
+	}
+	var body tLoginRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	sessionId, identity, err := auth.Login(body.Name, body.Password)
+	if err == errLoginFailed {
+		return nil, &TApiError{Status: http.StatusUnauthorized, Code: "login_failed", Message: err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+	return tApiCookie{
+		Cookie: &http.Cookie{Name: sessionCookie, Value: sessionId, Path: "/", HttpOnly: true,
+			Secure: req.TLS != nil, SameSite: http.SameSiteStrictMode},
+		Body: tWhoAmIResponse{AuthEnabled: true, LoggedIn: true, TIdentity: identity},
+	}, nil
+}
+
+func apiV1Logout(req *http.Request) (interface{}, error) {
+	if auth == nil {
+		return nil, errAuthDisabled
+	}
+	if cookie, err := req.Cookie(sessionCookie); err == nil {
+		auth.Logout(cookie.Value)
+	}
+	return tApiCookie{Cookie: &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1}}, nil
+}
+
+func apiV1WhoAmI(req *http.Request) (interface{}, error) {
+	identity := identityOf(req)
+	return tWhoAmIResponse{AuthEnabled: auth != nil, LoggedIn: identity.Role != RoleNone, TIdentity: identity}, nil
+}
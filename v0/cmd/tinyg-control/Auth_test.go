@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	token := sha256.Sum256([]byte("scripttoken"))
+	path := filepath.Join(dir, "users.yaml")
+	ioutil.WriteFile(path, []byte("users:\n  - name: anna\n    password: "+string(hash)+"\n    role: viewer\n"+
+		"tokens:\n  - name: script\n    sha256: "+hex.EncodeToString(token[:])+"\n    role: operator\n"), 0644)
+	testAuth, err := LoadAuth(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = testAuth.Login("anna", "wrong"); err != errLoginFailed {
+		t.Error("Wrong password accepted")
+	}
+	session, _, err := testAuth.Login("anna", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := testAuth.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	request := func(method, path, credential string) int {
+		req := httptest.NewRequest(method, path, nil)
+		switch credential {
+		case "session":
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+		case "token":
+			req.Header.Set("Authorization", "Bearer scripttoken")
+		case "basic":
+			req.SetBasicAuth("anna", "secret")
+		case "wrong":
+			req.SetBasicAuth("anna", "guess")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cases := []struct {
+		method, path, credential string
+		code                     int
+	}{
+		{"GET", "/login.html", "", http.StatusOK},
+		{"GET", "/index.html", "", http.StatusFound},
+		{"GET", "/api/v1/state", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/state", "session", http.StatusOK},
+		{"POST", "/api/v1/jog", "session", http.StatusForbidden},
+		{"POST", "/api/v1/jog", "token", http.StatusOK},
+		{"POST", "/api/v1/reset", "token", http.StatusForbidden},
+		{"POST", "/api/v1/exit", "token", http.StatusForbidden},
+		{"GET", "/api/v1/state", "basic", http.StatusOK},
+		{"GET", "/api/v1/state", "basic", http.StatusOK}, // cached
+		{"GET", "/api/v1/state", "wrong", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		if code := request(c.method, c.path, c.credential); code != c.code {
+			t.Error(c.method, " ", c.path, " with ", c.credential, ": ", code, " instead of ", c.code)
+		}
+	}
+	if len(testAuth.basic) != 1 {
+		t.Error("Basic auth not cached: ", len(testAuth.basic))
+	}
+	for _, entry := range testAuth.basic {
+		entry.expires = time.Now().Add(-time.Second)
+	}
+	if code := request("GET", "/api/v1/state", "wrong"); code != http.StatusUnauthorized {
+		t.Error("Wrong password accepted: ", code)
+	}
+	if code := request("GET", "/api/v1/state", "basic"); code != http.StatusOK || len(testAuth.basic) != 1 {
+		t.Error("Expired check not renewed: ", code, len(testAuth.basic))
+	}
+	testAuth.Logout(session)
+	if code := request("GET", "/api/v1/state", "session"); code != http.StatusUnauthorized {
+		t.Error("Session still valid after logout: ", code)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/itschleemilch/huanyango/v1/vfdio"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to the upper case flag name for environment
+// variables, e.g. TINYG_CONTROL_TINYG_PORT for -tinyg-port.
+const envPrefix string = "TINYG_CONTROL_"
+
+// TConfig is the configuration of the server. Values are taken from the
+// flag defaults, the YAML config file, the environment and the flags
+// given on the command line, later sources override earlier ones.
+type TConfig struct {
+	Listen     string            `yaml:"listen"`
+	StaticDir  string            `yaml:"static"`
+	TinygPort  string            `yaml:"tinygPort"`
+	Vfd        TVfdConfig        `yaml:"vfd"`
+	Spindle    TSpindleConfig    `yaml:"spindle"`
+	Machine    TMachineConfig    `yaml:"machine"`
+	ToolChange TToolChangeConfig `yaml:"toolChange"`
+	Files      TFilesConfig      `yaml:"files"`
+	Auth       TAuthConfig       `yaml:"auth"`
+	Tls        TTlsConfig        `yaml:"tls"`
+}
+
+type TVfdConfig struct {
+	Port     string  `yaml:"port"`
+	Interval int64   `yaml:"interval"` // status readout interval in ms
+	RpmToHz  float64 `yaml:"rpm2hz"`
+	MaxRpm   int64   `yaml:"maxRpm"`
+}
+
+type TSpindleConfig struct {
+	Driver         string        `yaml:"driver"`
+	SpinUp         time.Duration `yaml:"spinUp"`    // pwm driver only
+	Tolerance      float64       `yaml:"tolerance"` // percent
+	StallPercent   float64       `yaml:"stall"`
+	AtSpeedTimeout time.Duration `yaml:"timeout"`
+}
+
+type TMachineConfig struct {
+	SafeZ        float64        `yaml:"safeZ"`
+	RequireHomed string         `yaml:"requireHomed"`
+	EnvelopeMin  tgjson.TOffset `yaml:"envelopeMin"`
+	EnvelopeMax  tgjson.TOffset `yaml:"envelopeMax"`
+	RapidFeed    float64        `yaml:"rapidFeed"`
+}
+
+type TToolChangeConfig struct {
+	Position      string  `yaml:"position"`
+	ProbePosition string  `yaml:"probePosition"`
+	ProbeDistance float64 `yaml:"probeDistance"`
+	ProbeFeed     float64 `yaml:"probeFeed"`
+}
+
+type TFilesConfig struct {
+	Positions  string `yaml:"positions"`
+	Tools      string `yaml:"tools"`
+	HeightMaps string `yaml:"heightmaps"`
+	Library    string `yaml:"library"`
+	JobHistory string `yaml:"jobHistory"`
+}
+
+type TAuthConfig struct {
+	UsersFile      string        `yaml:"usersFile"` // authentication is disabled if empty
+	SessionTimeout time.Duration `yaml:"sessionTimeout"`
+	ControlTimeout time.Duration `yaml:"controlTimeout"`
+}
+
+type TTlsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Cert    string `yaml:"cert"` // a self-signed certificate is generated if empty
+	Key     string `yaml:"key"`
+}
+
+// Names of the generated certificate files, stored next to the config file.
+const (
+	generatedCertFile string = "tinyg-control.crt"
+	generatedKeyFile  string = "tinyg-control.key"
+)
+
+// tOffsetFlag is a flag value for positions given as "x,y,z".
+type tOffsetFlag struct {
+	offset *tgjson.TOffset
+}
+
+func (o tOffsetFlag) String() string {
+	if o.offset == nil {
+		return ""
+	}
+	return fmt.Sprint(o.offset.X, ",", o.offset.Y, ",", o.offset.Z)
+}
+
+func (o tOffsetFlag) Set(value string) (err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return errors.New("expected x,y,z")
+	}
+	values := make([]float64, 3)
+	for n, part := range parts {
+		if values[n], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return
+		}
+	}
+	*o.offset = tgjson.TOffset{X: values[0], Y: values[1], Z: values[2]}
+	return
+}
+
+// bindFlags registers the flags for all settings with their defaults
+// and returns the names of the registered flags.
+func (o *TConfig) bindFlags(fs *flag.FlagSet) (names []string) {
+	existing := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		existing[f.Name] = true
+	})
+	fs.StringVar(&o.Listen, "listen", ":8080", "Listen address of the web server.")
+	fs.StringVar(&o.StaticDir, "static", "", "Serve the web interface from this directory instead of the embedded files, e.g. for UI development.")
+	fs.StringVar(&o.TinygPort, "tinyg-port", "/dev/ttyTinyg", "Serial port of TinyG. On Linux a symbolic link can be created using udev rules, see https://unix.stackexchange.com/a/183492.")
+	fs.StringVar(&o.Vfd.Port, "port", "/dev/ttyMotorspindel", "Serial port of the VFD. Linux default: /dev/ttyUSB0. On Windows use COMx, e.g. COM3.")
+	fs.Int64Var(&o.Vfd.Interval, "interval", 750, "RPM status readout interval in milliseconds.")
+	fs.Float64Var(&o.Vfd.RpmToHz, "rpm2hz", 3.47222, "Unit conversation from RPM to Hz. May be determined experimentally.")
+	fs.Int64Var(&o.Vfd.MaxRpm, "maxrpm", 11520, "Maximum allowed RPM for your spindle.")
+	fs.StringVar(&o.Spindle.Driver, "spindle", SpindleHuanyang, "Spindle driver: "+strings.Join(spindleDrivers, ", ")+".")
+	fs.DurationVar(&o.Spindle.SpinUp, "spindle-spinup", 3*time.Second, "Spin-up time of a spindle without speed feedback (pwm driver).")
+	fs.Float64Var(&o.Spindle.Tolerance, "spindle-tolerance", 5, "Allowed deviation of the measured from the commanded RPM in percent.")
+	fs.Float64Var(&o.Spindle.StallPercent, "spindle-stall", 70, "Minimum RPM during a job in percent of the commanded RPM. Lower values trigger a feed hold. 0 disables the stall detection.")
+	fs.DurationVar(&o.Spindle.AtSpeedTimeout, "spindle-timeout", 10*time.Second, "Maximum time to wait for the spindle to reach the commanded RPM before a feed hold is sent. 0 disables waiting.")
+	fs.Float64Var(&o.Machine.SafeZ, "safe-z", 0, "Machine Z coordinate to retract to before moving to a saved position.")
+	fs.StringVar(&o.Machine.RequireHomed, "require-homed", "", "Axes which have to be homed before a program can be started, e.g. XYZ.")
+	fs.Var(tOffsetFlag{&o.Machine.EnvelopeMin}, "envelope-min", "Lower limits of the machine envelope in machine coordinates as x,y,z.")
+	fs.Var(tOffsetFlag{&o.Machine.EnvelopeMax}, "envelope-max", "Upper limits of the machine envelope in machine coordinates as x,y,z. Axes with max <= min are not limited.")
+	fs.Float64Var(&o.Machine.RapidFeed, "rapid-feed", 5000, "Traverse rate in mm/min for the run time estimate of files.")
+	fs.StringVar(&o.ToolChange.Position, "toolchange", "", "Saved position for manual tool changes. M6 is passed to TinyG if not set.")
+	fs.StringVar(&o.ToolChange.ProbePosition, "toolchange-probe", "", "Saved position above the tool length sensor. Tool lengths are not measured if not set.")
+	fs.Float64Var(&o.ToolChange.ProbeDistance, "toolchange-probe-distance", 50, "Maximum probing distance for the tool length measurement.")
+	fs.Float64Var(&o.ToolChange.ProbeFeed, "toolchange-probe-feed", 50, "Probing feed rate for the tool length measurement.")
+	fs.StringVar(&o.Files.Positions, "positions", "positions.json", "File for named machine positions.")
+	fs.StringVar(&o.Files.Tools, "tools", "tools.json", "File for the tool table.")
+	fs.StringVar(&o.Files.HeightMaps, "heightmap-dir", "heightmaps", "Directory for saved height maps.")
+	fs.StringVar(&o.Files.Library, "library-dir", "gcode", "Directory for uploaded G-code files.")
+	fs.StringVar(&o.Files.JobHistory, "job-history", "jobs.jsonl", "File for the history of finished jobs.")
+	fs.StringVar(&o.Auth.UsersFile, "users", "", "YAML file with users and API tokens. Everybody has full access if not set.")
+	fs.DurationVar(&o.Auth.SessionTimeout, "session-timeout", 12*time.Hour, "Logout after this time without requests.")
+	fs.BoolVar(&o.Tls.Enabled, "tls", false, "Serve HTTPS instead of HTTP.")
+	fs.StringVar(&o.Tls.Cert, "tls-cert", "", "TLS certificate (PEM). A self-signed certificate is generated next to the config file if not set.")
+	fs.StringVar(&o.Tls.Key, "tls-key", "", "Private key of the TLS certificate (PEM).")
+	fs.DurationVar(&o.Auth.ControlTimeout, "control-timeout", time.Minute, "Release the control lock after this time without requests of the holder.")
+	fs.VisitAll(func(f *flag.Flag) {
+		if !existing[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+	return
+}
+
+// Spindle drivers
+const (
+	SpindleNone      string = "none"
+	SpindleHuanyang  string = "huanyang"
+	SpindlePwm       string = "pwm"
+	SpindleSimulated string = "simulated"
+)
+
+var spindleDrivers = []string{SpindleNone, SpindleHuanyang, SpindlePwm, SpindleSimulated}
+
+// simulatedAcceleration is the acceleration of the simulated spindle in RPM/s.
+const simulatedAcceleration float64 = 5000
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenSpindle creates the configured spindle driver, nil for "none".
+func (o *TConfig) OpenSpindle() (spindle.Spindle, error) {
+	switch o.Spindle.Driver {
+	case SpindleNone:
+		return nil, nil
+	case SpindleHuanyang:
+		vfd := vfdio.NewVfd()
+		vfd.Open(o.Vfd.Port, uint16(o.Vfd.MaxRpm), o.Vfd.RpmToHz, o.Vfd.Interval)
+		hySpindle := spindle.NewHuanyang(vfd)
+		hySpindle.Tolerance = o.Spindle.Tolerance / 100
+		return hySpindle, nil
+	case SpindlePwm:
+		return spindle.NewPwm(o.Spindle.SpinUp), nil
+	case SpindleSimulated:
+		simSpindle := spindle.NewSimulated(simulatedAcceleration)
+		simSpindle.Tolerance = o.Spindle.Tolerance / 100
+		return simSpindle, nil
+	}
+	return nil, fmt.Errorf("unknown spindle driver %q", o.Spindle.Driver)
+}
+
+// envName returns the environment variable of a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// load applies the config file and the environment to the parsed flags.
+// Flags given on the command line keep their values.
+func (o *TConfig) load(fs *flag.FlagSet, names []string, path string) error {
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = yaml.UnmarshalStrict(data, o); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(envName(name)); ok {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: %v", envName(name), err)
+			}
+		}
+	}
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TlsFiles returns the certificate and key files. Without configured files
+// the generated ones in the directory of the config file are used.
+func (o *TConfig) TlsFiles(configFile string) (certFile, keyFile string) {
+	if len(o.Tls.Cert) > 0 {
+		return o.Tls.Cert, o.Tls.Key
+	}
+	dir := "."
+	if len(configFile) > 0 {
+		dir = filepath.Dir(configFile)
+	}
+	return filepath.Join(dir, generatedCertFile), filepath.Join(dir, generatedKeyFile)
+}
+
+// Envelope returns the machine envelope for the controller.
+func (o *TConfig) Envelope() tinyg.TEnvelope {
+	return tinyg.TEnvelope{Min: o.Machine.EnvelopeMin, Max: o.Machine.EnvelopeMax}
+}
+
+// Validate checks the configuration and returns all problems at once.
+func (o *TConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	_, _, err := net.SplitHostPort(o.Listen)
+	check(err == nil, "listen: invalid address %q", o.Listen)
+	if len(o.StaticDir) > 0 {
+		info, err := os.Stat(o.StaticDir)
+		check(err == nil && info.IsDir(), "static: %q is not a directory", o.StaticDir)
+	}
+	check(len(o.TinygPort) > 0, "tinygPort: missing")
+	check(o.Spindle.Driver != SpindleHuanyang || len(o.Vfd.Port) > 0, "vfd.port: missing")
+	check(o.Vfd.Interval > 0, "vfd.interval: has to be positive")
+	check(o.Vfd.RpmToHz > 0, "vfd.rpm2hz: has to be positive")
+	check(o.Vfd.MaxRpm > 0 && o.Vfd.MaxRpm <= 0xFFFF, "vfd.maxRpm: out of range")
+	check(contains(spindleDrivers, o.Spindle.Driver), "spindle.driver: has to be one of %s", strings.Join(spindleDrivers, ", "))
+	check(o.Spindle.SpinUp >= 0, "spindle.spinUp: must not be negative")
+	check(o.Spindle.Tolerance > 0 && o.Spindle.Tolerance <= 100, "spindle.tolerance: has to be in (0, 100]")
+	check(o.Spindle.StallPercent >= 0 && o.Spindle.StallPercent <= 100, "spindle.stall: has to be in [0, 100]")
+	check(o.Spindle.AtSpeedTimeout >= 0, "spindle.timeout: must not be negative")
+	check(strings.Trim(strings.ToUpper(o.Machine.RequireHomed), "XYZA") == "",
+		"machine.requireHomed: only X, Y, Z and A allowed")
+	envelope := o.Envelope()
+	check(envelope.Max.X >= envelope.Min.X, "machine.envelopeMax: x below envelopeMin")
+	check(envelope.Max.Y >= envelope.Min.Y, "machine.envelopeMax: y below envelopeMin")
+	check(envelope.Max.Z >= envelope.Min.Z, "machine.envelopeMax: z below envelopeMin")
+	check(envelope.ContainsAxis("Z", o.Machine.SafeZ), "machine.safeZ: outside of the envelope")
+	check(len(o.ToolChange.ProbePosition) == 0 || len(o.ToolChange.Position) > 0,
+		"toolChange.probePosition: requires toolChange.position")
+	check(o.ToolChange.ProbeDistance > 0, "toolChange.probeDistance: has to be positive")
+	check(o.ToolChange.ProbeFeed > 0, "toolChange.probeFeed: has to be positive")
+	check(len(o.Files.Positions) > 0, "files.positions: missing")
+	check(len(o.Files.Tools) > 0, "files.tools: missing")
+	check(len(o.Files.HeightMaps) > 0, "files.heightmaps: missing")
+	check(len(o.Files.Library) > 0, "files.library: missing")
+	check(len(o.Files.JobHistory) > 0, "files.jobHistory: missing")
+	check(o.Machine.RapidFeed > 0, "machine.rapidFeed: has to be positive")
+	check(o.Auth.SessionTimeout > 0, "auth.sessionTimeout: has to be positive")
+	check(o.Auth.ControlTimeout > 0, "auth.controlTimeout: has to be positive")
+	check((len(o.Tls.Cert) > 0) == (len(o.Tls.Key) > 0), "tls: cert and key have to be set together")
+	for _, file := range []string{o.Tls.Cert, o.Tls.Key} {
+		if o.Tls.Enabled && len(file) > 0 {
+			_, err := os.Stat(file)
+			check(err == nil, "tls: %v", err)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(path, []byte("listen: \":9000\"\ntinygPort: /dev/file\nvfd:\n  maxRpm: 24000\n"), 0644)
+	os.Setenv(envName("tinyg-port"), "/dev/env")
+	defer os.Unsetenv(envName("tinyg-port"))
+
+	config := &TConfig{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("other", false, "")
+	names := config.bindFlags(fs)
+	if contains(names, "other") || !contains(names, "control-timeout") || len(names) < 30 {
+		t.Error("Wrong flag names: ", names)
+	}
+	fs.Parse([]string{"-maxrpm=12000", "-envelope-max=600,400,0"})
+	if err = config.load(fs, names, path); err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != ":9000" || config.TinygPort != "/dev/env" || config.Vfd.MaxRpm != 12000 || config.Machine.EnvelopeMax.Y != 400 {
+		t.Errorf("Wrong precedence: %+v", config)
+	}
+	if err = config.Validate(); err != nil {
+		t.Error(err)
+	}
+	config.StaticDir = path
+	config.Spindle.Tolerance = 0
+	if err = config.Validate(); err == nil || !strings.Contains(err.Error(), "static") || !strings.Contains(err.Error(), "tolerance") {
+		t.Error("Invalid settings accepted: ", err)
+	}
+}
+
+func TestConfigSpindle(t *testing.T) {
+	os.Setenv(envName("spindle"), "none")
+	defer os.Unsetenv(envName("spindle"))
+	drivers := map[string]string{
+		"-port=":             "<nil>", // no VFD required without the huanyang driver
+		"-spindle=simulated": "*spindle.TSimulated",
+		"-spindle=pwm":       "*spindle.TPwm",
+	}
+	for arg, driver := range drivers {
+		config := &TConfig{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		names := config.bindFlags(fs)
+		fs.Parse([]string{arg})
+		if err := config.load(fs, names, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.Validate(); err != nil {
+			t.Error(arg, err)
+		}
+		if spindle, err := config.OpenSpindle(); err != nil || fmt.Sprintf("%T", spindle) != driver {
+			t.Errorf("%s: driver %T, expected %s", arg, spindle, driver)
+		}
+	}
+
+	config := &TConfig{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	config.bindFlags(fs)
+	fs.Parse([]string{"-spindle=huanyang", "-port="})
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "vfd.port") {
+		t.Error("Huanyang driver accepted without port: ", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"github.com/golang/glog"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// consoleHistoryLength is the number of commands kept for recalling.
+const consoleHistoryLength int = 100
+
+// TConsoleHistory holds the commands sent from the console, shared by
+// all browsers.
+type TConsoleHistory struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+// Add appends a command. Repeating the last command is not recorded again.
+func (o *TConsoleHistory) Add(line string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.lines) > 0 && o.lines[len(o.lines)-1] == line {
+		return
+	}
+	o.lines = append(o.lines, line)
+	if len(o.lines) > consoleHistoryLength {
+		o.lines = o.lines[len(o.lines)-consoleHistoryLength:]
+	}
+}
+
+// Lines returns the commands, oldest first.
+func (o *TConsoleHistory) Lines() []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append(make([]string, 0, len(o.lines)), o.lines...)
+}
+
+var consoleHistory TConsoleHistory
+
+// apiV1Console returns the buffered serial traffic newer than ?since.
+// Polling requests and their responses are only included with ?polls=true.
+func apiV1Console(req *http.Request) (interface{}, error) {
+	since := 0
+	if value := req.URL.Query().Get("since"); len(value) > 0 {
+		var err error
+		if since, err = strconv.Atoi(value); err != nil {
+			return nil, badRequest("since must be a line id")
+		}
+	}
+	return tgHandle.Console(since, queryBool(req, "polls")), nil
+}
+
+// apiV1ConsoleStream sends the buffered and all new lines as "line" events.
+func apiV1ConsoleStream(req *http.Request) (interface{}, error) {
+	polls := queryBool(req, "polls")
+	return tApiStream(func(w http.ResponseWriter, req *http.Request) {
+		lines, cancel := tgHandle.SubscribeConsole()
+		defer cancel()
+		buffered := tgHandle.Console(0, polls)
+		initial := make([]tEvent, len(buffered))
+		for n, line := range buffered {
+			initial[n] = newEvent("line", line)
+		}
+		last := 0
+		if len(buffered) > 0 {
+			last = buffered[len(buffered)-1].Id
+		}
+		events := make(chan tEvent, eventSubscriberBacklog)
+		go func() {
+			for {
+				select {
+				case line := <-lines:
+					if line.Id <= last || (line.Poll && !polls) {
+						continue // already sent as buffered line or filtered
+					}
+					select {
+					case events <- newEvent("line", line):
+					default: // client too slow
+					}
+				case <-req.Context().Done():
+					return
+				}
+			}
+		}()
+		serveEvents(w, req, events, initial)
+	}), nil
+}
+
+type tConsoleRequest struct {
+	Line string `json:"line"`
+}
+
+// apiV1ConsoleSend sends a raw JSON command or G-code line to TinyG.
+// Settings are changed by admins only, like the configuration.
+func apiV1ConsoleSend(req *http.Request) (interface{}, error) {
+	var body tConsoleRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	line := strings.TrimSpace(body.Line)
+	if tinyg.IsSetting(line) && identityOf(req).Role < RoleAdmin {
+		return nil, &TApiError{Status: http.StatusForbidden, Code: "forbidden", Message: "role admin required for settings"}
+	}
+	if err := tgHandle.SendConsole(line); err != nil {
+		return nil, err
+	}
+	glog.Infoln("Console ", identityOf(req).Name, ": ", line)
+	consoleHistory.Add(line)
+	return tApiStatus{Status: http.StatusAccepted}, nil
+}
+
+func apiV1ConsoleHistory(req *http.Request) (interface{}, error) {
+	return consoleHistory.Lines(), nil
+}
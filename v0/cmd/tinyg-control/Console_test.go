@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConsoleHistory(t *testing.T) {
+	var history TConsoleHistory
+	history.Add("{sr:n}")
+	history.Add("{sr:n}")
+	history.Add("G0 X1")
+	if lines := history.Lines(); len(lines) != 2 || lines[0] != "{sr:n}" {
+		t.Error("Wrong history: ", lines)
+	}
+	for n := 0; n < consoleHistoryLength; n++ {
+		history.Add("G0 X" + strconv.Itoa(n))
+	}
+	if lines := history.Lines(); len(lines) != consoleHistoryLength || lines[0] != "G0 X0" {
+		t.Error("History not limited: ", len(lines), lines[0])
+	}
+}
+
+func TestConsoleSettings(t *testing.T) {
+	for _, line := range []string{"{sr:n}", `{"fv":null}`, "$xvm", "G10 L2 P1 X0", "!"} {
+		if tinyg.IsSetting(line) {
+			t.Errorf("%q taken as setting", line)
+		}
+	}
+	operator := TIdentity{Name: "olga", Role: RoleOperator}
+	for _, line := range []string{`{"xvm":1000}`, "{sv:0}", "$xvm=1000"} {
+		req := httptest.NewRequest("POST", "/api/v1/console", strings.NewReader(`{"line":`+strconv.Quote(line)+`}`))
+		req = req.WithContext(context.WithValue(req.Context(), tIdentityKey{}, operator))
+		if _, err := apiV1ConsoleSend(req); apiErrorFrom(err).Code != "forbidden" {
+			t.Errorf("Setting %q sent by an operator: %v", line, err)
+		}
+	}
+}
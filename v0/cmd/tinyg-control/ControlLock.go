@@ -0,0 +1,281 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// controlTokenHeader carries the token issued to the holder of the lock.
+// The server answers commands which acquired the lock with it, clients
+// send it back with their following requests.
+const controlTokenHeader string = "X-Control-Token"
+
+// TLockHolder is the client controlling the machine as shown to all clients.
+type TLockHolder struct {
+	User  string    `json:"user"`
+	Since time.Time `json:"since"`
+}
+
+// TControlState is pushed to all clients as "control" event.
+type TControlState struct {
+	Held   bool         `json:"held"`
+	Holder *TLockHolder `json:"holder,omitempty"`
+}
+
+// tLockOwner identifies the holder, it is never sent to other clients.
+type tLockOwner struct {
+	TLockHolder
+	token   string // issued by the server on acquiring
+	address string // host of a holder without token, set for scripts only
+}
+
+// TControlLock allows motion commands from one client only. Other clients
+// are observers until the lock is released, has timed out or is taken over.
+type TControlLock struct {
+	Timeout time.Duration // release after this time without requests of the holder
+
+	lock     sync.Mutex
+	owner    *tLockOwner
+	lastSeen time.Time
+	events   *TEventHub
+	ticker   *time.Ticker
+	done     chan struct{}
+}
+
+func NewControlLock(timeout time.Duration, events *TEventHub) *TControlLock {
+	o := &TControlLock{Timeout: timeout, events: events, ticker: time.NewTicker(time.Second), done: make(chan struct{})}
+	go o.expireLoop()
+	return o
+}
+
+// Close stops the expiry of the lock.
+func (o *TControlLock) Close() {
+	o.ticker.Stop()
+	close(o.done)
+}
+
+// owns tells whether req comes from the holder. The holder is identified by
+// the authenticated user and the issued token, requests without token by the
+// user and the address which acquired the lock without token.
+func (o *TControlLock) owns(req *http.Request) bool {
+	if o.owner == nil || o.owner.User != identityOf(req).Name {
+		return false
+	}
+	if token := req.Header.Get(controlTokenHeader); len(token) > 0 {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(o.owner.token)) == 1
+	}
+	return len(o.owner.address) > 0 && o.owner.address == hostOf(req)
+}
+
+func hostOf(req *http.Request) string {
+	host, _, _ := net.SplitHostPort(req.RemoteAddr)
+	return host
+}
+
+// State returns the current holder.
+func (o *TControlLock) State() TControlState {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state()
+}
+
+func (o *TControlLock) state() TControlState {
+	if o.owner == nil {
+		return TControlState{}
+	}
+	holder := o.owner.TLockHolder
+	return TControlState{Held: true, Holder: &holder}
+}
+
+// Owns tells whether req comes from the holder of the lock.
+func (o *TControlLock) Owns(req *http.Request) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.owns(req)
+}
+
+func (o *TControlLock) publish() {
+	o.events.Publish("control", o.state())
+}
+
+// Acquire takes the lock for the client of req. A lock held by another
+// client is only taken over with force. The returned token is empty if the
+// client already held the lock.
+func (o *TControlLock) Acquire(req *http.Request, force bool) (string, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.owns(req) {
+		o.lastSeen = time.Now()
+		return "", nil
+	}
+	if o.owner != nil && !force {
+		return "", o.lockedError()
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	o.owner = &tLockOwner{
+		TLockHolder: TLockHolder{User: identityOf(req).Name, Since: time.Now()},
+		token:       token,
+	}
+	o.lastSeen = time.Now()
+	if len(req.Header.Get(controlTokenHeader)) == 0 {
+		o.owner.address = hostOf(req)
+	}
+	o.publish()
+	return token, nil
+}
+
+// Release frees the lock if it is held by the client of req.
+func (o *TControlLock) Release(req *http.Request) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.owner == nil {
+		return nil
+	}
+	if !o.owns(req) {
+		return o.lockedError()
+	}
+	o.owner = nil
+	o.publish()
+	return nil
+}
+
+func (o *TControlLock) lockedError() *TApiError {
+	msg := "machine is controlled by another client"
+	if len(o.owner.User) > 0 {
+		msg = "machine is controlled by " + o.owner.User
+	}
+	return &TApiError{Status: http.StatusConflict, Code: "control_locked", Message: msg}
+}
+
+// touch keeps the lock of an active holder.
+func (o *TControlLock) touch(req *http.Request) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.owns(req) {
+		o.lastSeen = time.Now()
+	}
+}
+
+func (o *TControlLock) expireLoop() {
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-o.ticker.C:
+		}
+		o.expire()
+	}
+}
+
+func (o *TControlLock) expire() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.owner != nil && time.Since(o.lastSeen) > o.Timeout {
+		o.owner = nil
+		o.publish()
+	}
+}
+
+// lockExemptPaths are allowed for everybody who may send commands,
+// stopping the machine must never be blocked.
+var lockExemptPaths = map[string]bool{
+	apiV1Prefix + "/feedhold":        true,
+	apiV1Prefix + "/flush":           true,
+	apiV1Prefix + "/jog/stop":        true,
+	apiV1Prefix + "/files":           true, // upload and delete do not move the machine
+	apiV1Prefix + "/files/rename":    true,
+	apiV1Prefix + "/login":           true,
+	apiV1Prefix + "/logout":          true,
+	apiV1Prefix + "/control/acquire": true,
+	apiV1Prefix + "/control/release": true,
+}
+
+// Handler checks the lock for all requests which need more than the viewer
+// role. A free lock is acquired by the first command.
+func (o *TControlLock) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		o.touch(req)
+		if requiredRole(req) >= RoleOperator && !lockExemptPaths[req.URL.Path] {
+			token, err := o.Acquire(req, false)
+			if err != nil {
+				writeAuthError(w, req, http.StatusConflict, "control_locked", err.Error())
+				return
+			}
+			if len(token) > 0 {
+				w.Header().Set(controlTokenHeader, token)
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+type tControlRequest struct {
+	Force bool `json:"force"` // take over the lock from another client
+}
+
+type tControlResponse struct {
+	TControlState
+	Mine  bool   `json:"mine"`
+	Token string `json:"token,omitempty"` // only answered to a new holder
+}
+
+func controlResponse(req *http.Request) tControlResponse {
+	return tControlResponse{TControlState: controlLock.State(), Mine: controlLock.Owns(req)}
+}
+
+func apiV1Control(req *http.Request) (interface{}, error) {
+	return controlResponse(req), nil
+}
+
+func apiV1ControlAcquire(req *http.Request) (interface{}, error) {
+	var body tControlRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	token, err := controlLock.Acquire(req, body.Force)
+	if err != nil {
+		return nil, err
+	}
+	response := controlResponse(req)
+	if len(token) > 0 {
+		response.Token = token
+		response.Mine = true
+	}
+	return response, nil
+}
+
+func apiV1ControlRelease(req *http.Request) (interface{}, error) {
+	if err := controlLock.Release(req); err != nil {
+		return nil, err
+	}
+	return controlResponse(req), nil
+}
+
+// apiV1Events streams the control state, alarms and other events.
+func apiV1Events(req *http.Request) (interface{}, error) {
+	return tApiStream(func(w http.ResponseWriter, req *http.Request) {
+		eventHub.Serve(w, req, newEvent("control", controlLock.State()))
+	}), nil
+}
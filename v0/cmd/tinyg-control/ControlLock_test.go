@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlLock(t *testing.T) {
+	hub := NewEventHub()
+	events, cancel := hub.Subscribe()
+	defer cancel()
+	lock := NewControlLock(time.Hour, hub)
+	defer lock.Close()
+	handler := lock.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	newRequest := func(user, host, token, method, path string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = host + ":1234"
+		if len(token) > 0 {
+			req.Header.Set(controlTokenHeader, token)
+		}
+		return req.WithContext(context.WithValue(req.Context(), tIdentityKey{}, TIdentity{Name: user, Role: RoleOperator}))
+	}
+	request := func(user, host, token, method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(user, host, token, method, path))
+		return rec
+	}
+	rec := request("alice", "10.0.0.1", "", "POST", "/api/v1/jog")
+	token := rec.Header().Get(controlTokenHeader)
+	if rec.Code != http.StatusOK || len(token) == 0 {
+		t.Fatal("Free lock not acquired: ", rec.Code, token)
+	}
+	if event := <-events; event.Name != "control" || !strings.Contains(string(event.Data), `"user":"alice"`) ||
+		strings.Contains(string(event.Data), token) {
+		t.Error("Wrong event: ", event.Name, string(event.Data))
+	}
+	tests := []struct {
+		user, host, token, method, path string
+		code                            int
+	}{
+		{"alice", "10.0.0.1", "", "POST", "/api/v1/jog", http.StatusOK},
+		{"alice", "10.0.0.2", token, "POST", "/api/v1/jog", http.StatusOK},
+		{"alice", "10.0.0.2", "", "POST", "/api/v1/jog", http.StatusConflict},
+		{"alice", "10.0.0.1", "guessed", "POST", "/api/v1/jog", http.StatusConflict},
+		{"bob", "10.0.0.1", token, "POST", "/api/v1/jog", http.StatusConflict},
+		{"bob", "10.0.0.3", "", "GET", "/api/v1/state", http.StatusOK},
+		{"bob", "10.0.0.3", "", "POST", "/api/v1/feedhold", http.StatusOK},
+	}
+	for _, test := range tests {
+		if rec := request(test.user, test.host, test.token, test.method, test.path); rec.Code != test.code {
+			t.Error(test.user, "@", test.host, " ", test.token, " ", test.path, ": ", rec.Code)
+		}
+	}
+	req := newRequest("bob", "10.0.0.3", "", "POST", "/api/v1/control/acquire")
+	if _, err := lock.Acquire(req, false); err == nil {
+		t.Error("Lock taken without force")
+	}
+	bobToken, err := lock.Acquire(req, true)
+	if err != nil || len(bobToken) == 0 || lock.State().Holder.User != "bob" || !lock.Owns(req) {
+		t.Error("Takeover failed: ", err, lock.State())
+	}
+	if rec := request("alice", "10.0.0.1", token, "POST", "/api/v1/jog"); rec.Code != http.StatusConflict {
+		t.Error("Command of previous holder accepted: ", rec.Code)
+	}
+	if lock.Release(newRequest("alice", "10.0.0.1", token, "POST", "/api/v1/control/release")) == nil {
+		t.Error("Lock released by previous holder")
+	}
+	if lock.Release(newRequest("bob", "10.0.0.4", bobToken, "POST", "/api/v1/control/release")) != nil || lock.State().Held {
+		t.Error("Release failed")
+	}
+}
+
+func TestControlLockExpiry(t *testing.T) {
+	hub := NewEventHub()
+	lock := NewControlLock(time.Minute/2, hub)
+	lock.Close()
+	req := httptest.NewRequest("POST", "/api/v1/control/acquire", nil)
+	if _, err := lock.Acquire(req, false); err != nil {
+		t.Fatal(err)
+	}
+	lock.expire()
+	if !lock.State().Held {
+		t.Fatal("Lock expired early")
+	}
+	lock.lastSeen = time.Now().Add(-time.Minute)
+	lock.expire()
+	if lock.State().Held {
+		t.Error("Lock held after timeout: ", lock.State())
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	hub := NewEventHub()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hub.Serve(w, req, newEvent("control", TControlState{}))
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Error("Wrong content type: ", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	if event := readEvent(); event != "event: control\ndata: {\"held\":false}\n" {
+		t.Errorf("Wrong initial event: %q", event)
+	}
+	hub.Publish("alarm", map[string]int{"id": 1})
+	if event := readEvent(); event != "event: alarm\ndata: {\"id\":1}\n" {
+		t.Errorf("Wrong event: %q", event)
+	}
+}
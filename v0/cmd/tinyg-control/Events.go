@@ -0,0 +1,124 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventSubscriberBacklog is the number of events buffered for a slow
+// client. Further events are dropped for this client.
+const eventSubscriberBacklog int = 64
+
+// eventKeepAlive is the interval of comments sent to idle event streams,
+// so that proxies do not close the connection.
+const eventKeepAlive time.Duration = 15 * time.Second
+
+// tEvent is a server-sent event with JSON data.
+type tEvent struct {
+	Name string
+	Data []byte
+}
+
+// TEventHub distributes events to all connected browsers.
+type TEventHub struct {
+	lock        sync.Mutex
+	subscribers map[chan tEvent]bool
+}
+
+func NewEventHub() *TEventHub {
+	return &TEventHub{subscribers: make(map[chan tEvent]bool)}
+}
+
+// Subscribe returns a channel receiving all published events.
+func (o *TEventHub) Subscribe() (events <-chan tEvent, cancel func()) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	subscriber := make(chan tEvent, eventSubscriberBacklog)
+	o.subscribers[subscriber] = true
+	cancel = func() {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		delete(o.subscribers, subscriber)
+	}
+	return subscriber, cancel
+}
+
+// Publish sends value encoded as JSON to all subscribers.
+func (o *TEventHub) Publish(name string, value interface{}) {
+	event := newEvent(name, value)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for subscriber := range o.subscribers {
+		select {
+		case subscriber <- event:
+		default: // client too slow
+		}
+	}
+}
+
+// Serve streams the events as text/event-stream until the client
+// disconnects. The initial events are sent first, e.g. the current state.
+func (o *TEventHub) Serve(w http.ResponseWriter, req *http.Request, initial ...tEvent) {
+	events, cancel := o.Subscribe()
+	defer cancel()
+	serveEvents(w, req, events, initial)
+}
+
+// serveEvents writes the initial events and then the events of the channel
+// as text/event-stream until the client disconnects.
+func serveEvents(w http.ResponseWriter, req *http.Request, events <-chan tEvent, initial []tEvent) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	for _, event := range initial {
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// newEvent encodes value for the initial events of Serve.
+func newEvent(name string, value interface{}) tEvent {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return tEvent{Name: name, Data: data}
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TJobHistory persists finished jobs, one JSON object per line. New
+// jobs are appended, so a crash can at most lose the last line.
+type TJobHistory struct {
+	path string
+	lock sync.Mutex
+}
+
+// TJobFilter selects jobs of the history. Empty fields match all jobs.
+type TJobFilter struct {
+	Name    string // part of the file name, case-insensitive
+	Hash    string
+	Outcome tinyg.TJobOutcome
+	From    time.Time // jobs started at or after From
+	To      time.Time // jobs started before To
+	Limit   int       // maximum number of jobs, 0 for all
+}
+
+func (o TJobFilter) match(job tinyg.TJob) bool {
+	return (len(o.Name) == 0 || strings.Contains(strings.ToLower(job.Name), strings.ToLower(o.Name))) &&
+		(len(o.Hash) == 0 || job.Hash == o.Hash) &&
+		(len(o.Outcome) == 0 || job.Outcome == o.Outcome) &&
+		(o.From.IsZero() || !job.Start.Before(o.From)) &&
+		(o.To.IsZero() || job.Start.Before(o.To))
+}
+
+// OpenJobHistory creates the history file if it does not exist yet.
+func OpenJobHistory(path string) (*TJobHistory, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &TJobHistory{path: path}, nil
+}
+
+// Append stores a finished job.
+func (o *TJobHistory) Append(job tinyg.TJob) error {
+	line, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if syncErr := f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Jobs returns the matching jobs, newest first. Damaged lines are skipped.
+func (o *TJobHistory) Jobs(filter TJobFilter) (jobs []tinyg.TJob, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	f, err := os.Open(o.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	jobs = make([]tinyg.TJob, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var job tinyg.TJob
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			glog.Warningln("Job history ", o.path, " line ", n, ": ", err)
+			continue
+		}
+		if filter.match(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+	if filter.Limit > 0 && len(jobs) > filter.Limit {
+		jobs = jobs[:filter.Limit]
+	}
+	return
+}
+
+// historyBlockSize is the amount of the history read at once by LastId.
+const historyBlockSize int64 = 64 * 1024
+
+// LastId returns the id of the last stored job or 0. Ids grow with every
+// job, so only the end of the history is read.
+func (o *TJobHistory) LastId() (id int, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	f, err := os.Open(o.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := end - historyBlockSize
+		if start < 0 {
+			start = 0
+		}
+		block := make([]byte, end-start)
+		if _, err = f.ReadAt(block, start); err != nil {
+			return 0, err
+		}
+		tail = append(block, tail...)
+		end = start
+		lines := bytes.Split(tail, []byte{'\n'})
+		for n := len(lines) - 1; n > 0 || (n == 0 && start == 0); n-- { // the first line may be cut
+			var job struct {
+				Id int `json:"id"`
+			}
+			if json.Unmarshal(lines[n], &job) == nil && job.Id > 0 {
+				return job.Id, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// csvText quotes text cells which spreadsheets would take as formula.
+func csvText(text string) string {
+	if len(text) > 0 && strings.IndexByte("=+-@", text[0]) >= 0 {
+		return "'" + text
+	}
+	return text
+}
+
+// jobsCsv exports jobs with one row per job. Offsets are given as x/y/z
+// columns of the active coordinate system and G92, alarms are joined.
+func jobsCsv(jobs []tinyg.TJob) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "name", "hash", "start", "end", "seconds", "outcome", "lines", "lines_done",
+		"cs", "cs_x", "cs_y", "cs_z", "g92_x", "g92_y", "g92_z", "tool", "alarms"})
+	number := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	for _, job := range jobs {
+		var end, seconds string
+		if !job.End.IsZero() {
+			end = job.End.Format(time.RFC3339)
+			seconds = number(job.End.Sub(job.Start).Round(time.Second).Seconds())
+		}
+		row := []string{strconv.Itoa(job.Id), csvText(job.Name), csvText(job.Hash), job.Start.Format(time.RFC3339), end, seconds,
+			csvText(string(job.Outcome)), strconv.Itoa(job.Lines), strconv.Itoa(job.LinesDone), csvText(job.CoordinateSystem)}
+		for _, cs := range []string{job.CoordinateSystem, "G92"} {
+			if offset, ok := job.Offsets[cs]; ok && len(cs) > 0 {
+				row = append(row, number(offset.X), number(offset.Y), number(offset.Z))
+			} else {
+				row = append(row, "", "", "")
+			}
+		}
+		alarms := make([]string, len(job.Alarms))
+		for n, alarm := range job.Alarms {
+			alarms[n] = fmt.Sprint(alarm.Status, " ", alarm.Message)
+		}
+		row = append(row, strconv.Itoa(job.Tool), csvText(strings.Join(alarms, "; ")))
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseFilterTime accepts RFC 3339 timestamps and dates. A date as
+// upper bound includes the whole day.
+func parseFilterTime(value string, upper bool) (t time.Time, err error) {
+	if len(value) == 0 {
+		return
+	}
+	if t, err = time.Parse(time.RFC3339, value); err == nil {
+		return
+	}
+	if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+		return t, badRequest("invalid time " + strconv.Quote(value) + ", use YYYY-MM-DD or RFC 3339")
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// apiV1JobsHistory lists finished jobs, filtered by ?name, ?hash, ?outcome,
+// ?from, ?to and ?limit. ?format=csv exports the jobs as CSV file.
+func apiV1JobsHistory(req *http.Request) (interface{}, error) {
+	query := req.URL.Query()
+	filter := TJobFilter{
+		Name:    query.Get("name"),
+		Hash:    query.Get("hash"),
+		Outcome: tinyg.TJobOutcome(query.Get("outcome")),
+	}
+	switch filter.Outcome {
+	case "", tinyg.JobCompleted, tinyg.JobCancelled, tinyg.JobAlarmed:
+	default:
+		return nil, badRequest("outcome must be completed, cancelled or alarmed")
+	}
+	var err error
+	if filter.From, err = parseFilterTime(query.Get("from"), false); err != nil {
+		return nil, err
+	}
+	if filter.To, err = parseFilterTime(query.Get("to"), true); err != nil {
+		return nil, err
+	}
+	if limit := query.Get("limit"); len(limit) > 0 {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return nil, badRequest("limit must be a positive number")
+		}
+	}
+	jobs, err := jobHistory.Jobs(filter)
+	if err != nil {
+		return nil, err
+	}
+	switch query.Get("format") {
+	case "", "json":
+		return jobs, nil
+	case "csv":
+		data, err := jobsCsv(jobs)
+		if err != nil {
+			return nil, err
+		}
+		return tApiRaw{ContentType: "text/csv; charset=utf-8", Data: data, Filename: "jobs.csv"}, nil
+	}
+	return nil, badRequest("format must be json or csv")
+}
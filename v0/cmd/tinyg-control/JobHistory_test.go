@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobHistoryLastId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jobs.jsonl")
+	history, _ := OpenJobHistory(path)
+	if id, err := history.LastId(); id != 0 || err != nil {
+		t.Error("Empty history: ", id, err)
+	}
+	// Jobs larger than a block and a damaged last line
+	alarms := make([]tinyg.TAlarmEvent, 2000)
+	history.Append(tinyg.TJob{Id: 7, Alarms: alarms})
+	history.Append(tinyg.TJob{Id: 8, Alarms: alarms})
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte(`{"id":9,"na`))
+	f.Close()
+	if id, err := history.LastId(); id != 8 || err != nil {
+		t.Error("Wrong last id: ", id, err)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	history, err := OpenJobHistory(filepath.Join(dir, "jobs.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.Local)
+	jobs := []tinyg.TJob{
+		{Id: 1, Name: "Front.nc", Hash: "aa", Start: start, End: start.Add(time.Minute), Outcome: tinyg.JobCompleted,
+			CoordinateSystem: "G54", Offsets: map[string]tgjson.TOffset{"G54": {X: 10, Y: 20, Z: -5}}},
+		{Id: 2, Name: "back.nc", Hash: "bb", Start: start.AddDate(0, 0, 1), Outcome: tinyg.JobAlarmed,
+			Alarms: []tinyg.TAlarmEvent{{Id: 1, Status: tgjson.StatusLimitSwitchHit, Message: "limit"}}},
+		{Id: 3, Name: "front.nc", Hash: "cc", Start: start.AddDate(0, 0, 2), Outcome: tinyg.JobCancelled},
+		{Id: 4, Name: "=cmd|' /C calc'!A0.nc", Hash: "dd", Start: start.AddDate(0, 0, 3), Outcome: tinyg.JobCompleted},
+	}
+	for _, job := range jobs {
+		if err = history.Append(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if id, _ := history.LastId(); id != 4 {
+		t.Error("Wrong last id: ", id)
+	}
+	found, _ := history.Jobs(TJobFilter{Name: "FRONT"})
+	if len(found) != 2 || found[0].Id != 3 || found[1].Offsets["G54"].X != 10 {
+		t.Error("Wrong jobs by name: ", found)
+	}
+	found, _ = history.Jobs(TJobFilter{From: start.AddDate(0, 0, 1), To: start.AddDate(0, 0, 2)})
+	if len(found) != 1 || found[0].Id != 2 || len(found[0].Alarms) != 1 {
+		t.Error("Wrong jobs by time: ", found)
+	}
+
+	jobHistory = history
+	defer func() { jobHistory = nil }()
+	mux := http.NewServeMux()
+	registerApiV1(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/jobs/history?outcome=completed&to=2024-03-01&format=csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if rec.Code != http.StatusOK || err != nil || len(rows) != 2 || rows[1][1] != "Front.nc" || rows[1][10] != "10" ||
+		!strings.Contains(rec.Header().Get("Content-Disposition"), "jobs.csv") {
+		t.Error("Wrong CSV export: ", rec.Code, rows, err)
+	}
+	if data, _ := jobsCsv(jobs[3:]); !strings.Contains(string(data), ",'=cmd|") {
+		t.Error("Formula not quoted: ", string(data))
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/jobs/history?outcome=running", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Error("Invalid outcome accepted: ", rec.Code)
+	}
+}
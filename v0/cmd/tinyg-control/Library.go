@@ -0,0 +1,333 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUploadSize limits uploaded programs.
+const maxUploadSize int64 = 64 << 20
+
+var (
+	ErrInvalidFileName = errors.New("invalid file name")
+	ErrNoSuchFile      = errors.New("no such file")
+	ErrFileExists      = errors.New("file already exists")
+)
+
+// TLibraryFile describes a stored program.
+type TLibraryFile struct {
+	Name     string          `json:"name"`
+	Size     int64           `json:"size"`
+	Modified time.Time       `json:"modified"`
+	Hash     string          `json:"hash"` // SHA-256 of the lines, as of running jobs
+	Analysis gcode.TAnalysis `json:"analysis"`
+}
+
+// TLibrary stores G-code programs in a directory. The analysis of a file
+// is cached until the file changes.
+type TLibrary struct {
+	Dir       string
+	RapidFeed float64 // traverse rate for the time estimate in mm/min
+
+	lock  sync.Mutex
+	cache map[string]TLibraryFile
+}
+
+func NewLibrary(dir string, rapidFeed float64) (*TLibrary, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TLibrary{Dir: dir, RapidFeed: rapidFeed, cache: make(map[string]TLibraryFile)}, nil
+}
+
+// checkFileName accepts plain file names without directories. Hidden
+// files are used for incomplete uploads.
+func checkFileName(name string) error {
+	if len(name) == 0 || len(name) > 200 || name != filepath.Base(name) || strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(name, "/\\\x00") {
+		return ErrInvalidFileName
+	}
+	return nil
+}
+
+func (o *TLibrary) path(name string) string {
+	return filepath.Join(o.Dir, name)
+}
+
+// List returns all files sorted by name.
+func (o *TLibrary) List() (files []TLibraryFile, err error) {
+	entries, err := ioutil.ReadDir(o.Dir)
+	if err != nil {
+		return
+	}
+	files = make([]TLibraryFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || checkFileName(entry.Name()) != nil {
+			continue
+		}
+		file, err := o.describe(entry)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return
+}
+
+// Get returns the description of a file.
+func (o *TLibrary) Get(name string) (file TLibraryFile, err error) {
+	if err = checkFileName(name); err != nil {
+		return
+	}
+	info, err := os.Stat(o.path(name))
+	if os.IsNotExist(err) {
+		return file, ErrNoSuchFile
+	} else if err != nil {
+		return
+	}
+	return o.describe(info)
+}
+
+// describe returns the cached description or analyzes the file.
+func (o *TLibrary) describe(info os.FileInfo) (file TLibraryFile, err error) {
+	o.lock.Lock()
+	cached, ok := o.cache[info.Name()]
+	o.lock.Unlock()
+	if ok && cached.Size == info.Size() && cached.Modified.Equal(info.ModTime()) {
+		return cached, nil
+	}
+	lines, err := o.readLines(info.Name())
+	if err != nil {
+		return
+	}
+	analysis, err := gcode.Analyze(strings.NewReader(strings.Join(lines, "\n")), o.RapidFeed)
+	if err != nil {
+		return
+	}
+	file = TLibraryFile{
+		Name:     info.Name(),
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+		Hash:     tinyg.ProgramHash(lines),
+		Analysis: analysis,
+	}
+	o.lock.Lock()
+	o.cache[file.Name] = file
+	o.lock.Unlock()
+	return
+}
+
+// Save stores a file. An existing file is only replaced with overwrite.
+// The data is written to a hidden file first, so that a failed upload
+// does not destroy the previous version.
+func (o *TLibrary) Save(name string, data io.Reader, overwrite bool) (file TLibraryFile, err error) {
+	if err = checkFileName(name); err != nil {
+		return
+	}
+	if _, statErr := os.Stat(o.path(name)); statErr == nil && !overwrite {
+		return file, ErrFileExists
+	}
+	tmp, err := ioutil.TempFile(o.Dir, ".upload-")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, io.LimitReader(data, maxUploadSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	if info, _ := os.Stat(tmp.Name()); info != nil && info.Size() > maxUploadSize {
+		return file, errors.New("file too large")
+	}
+	if err = os.Rename(tmp.Name(), o.path(name)); err != nil {
+		return
+	}
+	return o.Get(name)
+}
+
+// Rename changes the name of a file, existing files are not replaced.
+func (o *TLibrary) Rename(name, newName string) error {
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+	if err := checkFileName(newName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(o.path(name)); os.IsNotExist(err) {
+		return ErrNoSuchFile
+	}
+	if _, err := os.Stat(o.path(newName)); err == nil {
+		return ErrFileExists
+	}
+	return os.Rename(o.path(name), o.path(newName))
+}
+
+// Delete removes a file.
+func (o *TLibrary) Delete(name string) error {
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+	err := os.Remove(o.path(name))
+	if os.IsNotExist(err) {
+		return ErrNoSuchFile
+	}
+	o.lock.Lock()
+	delete(o.cache, name)
+	o.lock.Unlock()
+	return err
+}
+
+// Lines reads a program for running it.
+func (o *TLibrary) Lines(name string) (lines []string, file TLibraryFile, err error) {
+	if file, err = o.Get(name); err != nil {
+		return
+	}
+	lines, err = o.readLines(name)
+	return
+}
+
+// readLines reads a file without line endings.
+func (o *TLibrary) readLines(name string) (lines []string, err error) {
+	f, err := os.Open(o.path(name))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// apiV1Files lists the stored programs.
+func apiV1Files(req *http.Request) (interface{}, error) {
+	return library.List()
+}
+
+// apiV1FilesUpload stores the files of a multipart upload (field "file"),
+// ?overwrite=true replaces existing files.
+func apiV1FilesUpload(req *http.Request) (interface{}, error) {
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil, &TApiError{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type",
+			Message: "upload files as multipart/form-data"}
+	}
+	req.Body = http.MaxBytesReader(nil, req.Body, maxUploadSize)
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		return nil, &TApiError{Status: http.StatusBadRequest, Code: "invalid_body", Message: err.Error()}
+	}
+	defer req.MultipartForm.RemoveAll()
+	headers := req.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		return nil, badRequest("no file in field \"file\"")
+	}
+	saved := make([]TLibraryFile, 0, len(headers))
+	for _, header := range headers {
+		data, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		file, err := library.Save(header.Filename, data, queryBool(req, "overwrite"))
+		data.Close()
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, file)
+	}
+	return tApiStatus{Status: http.StatusCreated, Body: saved}, nil
+}
+
+func apiV1FilesDelete(req *http.Request) (interface{}, error) {
+	return nil, library.Delete(req.URL.Query().Get("name"))
+}
+
+// apiV1FilesContent downloads a program.
+func apiV1FilesContent(req *http.Request) (interface{}, error) {
+	name := req.URL.Query().Get("name")
+	if _, err := library.Get(name); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(library.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return tApiRaw{ContentType: "text/plain; charset=utf-8", Data: data}, nil
+}
+
+type tRenameRequest struct {
+	Name    string `json:"name"`
+	NewName string `json:"newName"`
+}
+
+func apiV1FilesRename(req *http.Request) (interface{}, error) {
+	var body tRenameRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	if err := library.Rename(body.Name, body.NewName); err != nil {
+		return nil, err
+	}
+	return library.Get(body.NewName)
+}
+
+type tRunRequest struct {
+	Name string `json:"name"`
+}
+
+// apiV1FilesRun starts a stored program as job.
+func apiV1FilesRun(req *http.Request) (interface{}, error) {
+	var body tRunRequest
+	if err := decodeBody(req, &body); err != nil {
+		return nil, err
+	}
+	lines, file, err := library.Lines(body.Name)
+	if err != nil {
+		return nil, err
+	}
+	job, err := tgHandle.RunJob(file.Name, lines)
+	if err != nil {
+		return nil, err
+	}
+	return tApiStatus{Status: http.StatusAccepted, Body: job}, nil
+}
+
+// apiV1Job returns the running or the last job.
+func apiV1Job(req *http.Request) (interface{}, error) {
+	job, ok := tgHandle.CurrentJob()
+	if !ok {
+		return nil, &TApiError{Status: http.StatusNotFound, Code: "no_job", Message: "no job has been started"}
+	}
+	return job, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLibrary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lib, err := NewLibrary(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../x.nc", ".hidden", "a/b.nc"} {
+		if _, err := lib.Save(name, strings.NewReader("G0 X1"), false); err != ErrInvalidFileName {
+			t.Errorf("Name %q accepted: %v", name, err)
+		}
+	}
+	file, err := lib.Save("part.nc", strings.NewReader("G0 X0 Y0\nG1 X10 F100\n"), false)
+	if err != nil || file.Analysis.Lines != 2 || file.Analysis.Max[0] != 10 || file.Analysis.Seconds != 6 {
+		t.Error("Wrong analysis: ", file, err)
+	}
+	if _, err = lib.Save("part.nc", strings.NewReader("G0 X1"), false); err != ErrFileExists {
+		t.Error("Existing file replaced: ", err)
+	}
+	if err = lib.Rename("part.nc", "part2.nc"); err != nil {
+		t.Error(err)
+	}
+	lines, renamed, err := lib.Lines("part2.nc")
+	if err != nil || len(lines) != 2 || renamed.Hash != file.Hash {
+		t.Error("Wrong lines: ", lines, err)
+	}
+	// Posted programs and files with other line endings have the same hash
+	crlf, _ := lib.Save("crlf.nc", strings.NewReader("G0 X0 Y0\r\nG1 X10 F100\r\n"), false)
+	if posted := tinyg.ProgramHash([]string{"G0 X0 Y0", "G1 X10 F100"}); file.Hash != posted || crlf.Hash != posted {
+		t.Error("Hash differs from posted program: ", file.Hash, crlf.Hash, posted)
+	}
+	lib.Delete("crlf.nc")
+	if err = lib.Delete("part.nc"); err != ErrNoSuchFile {
+		t.Error("Deleted missing file: ", err)
+	}
+	if err = lib.Delete("part2.nc"); err != nil {
+		t.Error(err)
+	}
+	if files, _ := lib.List(); len(files) != 0 {
+		t.Error("Files left: ", files)
+	}
+}
+
+func TestFilesUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	library, _ = NewLibrary(dir, 1000)
+	defer func() { library = nil }()
+	mux := http.NewServeMux()
+	registerApiV1(mux)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "upload.nc")
+	part.Write([]byte("G0 X1 Y2 Z3\n"))
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/v1/files", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"name":"upload.nc"`) {
+		t.Error("Upload failed: ", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/files/content?name=upload.nc", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "G0 X1 Y2 Z3\n" {
+		t.Error("Wrong content: ", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/v1/files?name=missing.nc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("Missing file not reported: ", rec.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := &TConfig{}
+	certFile, keyFile := config.TlsFiles(filepath.Join(dir, "config.yaml"))
+	if generated, err := ensureCertificate(certFile, keyFile, []string{"cnc", "localhost", "192.168.1.20"}); err != nil || !generated {
+		t.Fatal("Certificate not generated: ", err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.VerifyHostname("localhost") != nil || cert.VerifyHostname("192.168.1.20") != nil {
+		t.Error("Wrong names: ", cert.DNSNames, cert.IPAddresses)
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+		t.Error("Key readable by others: ", info.Mode())
+	}
+	fingerprint, _ := certificateFingerprint(certFile)
+	if generated, err := ensureCertificate(certFile, keyFile, []string{"other"}); err != nil || generated {
+		t.Error("Existing certificate replaced: ", err)
+	}
+	if again, _ := certificateFingerprint(certFile); again != fingerprint || len(fingerprint) != 95 {
+		t.Error("Wrong fingerprint: ", fingerprint, again)
+	}
+}
@@ -18,172 +18,273 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/golang/glog"
-	"github.com/itschleemilch/huanyango/v1/vfdio"
 	tinyg "github.com/itschleemilch/tinyg-api/v0/tinyg/controller"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"gopkg.in/yaml.v2"
 	"net/http"
-	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 var tgHandle *tinyg.TinygController
+var heightMapDir string
+var lastHeightMap *tinyg.THeightMap
+var lastHeightMapLock sync.Mutex
+var safeZ float64
+var spindleDriver string
+var auth *TAuth
+var eventHub = NewEventHub()
+var controlLock *TControlLock
+var library *TLibrary
+var jobHistory *TJobHistory
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
-		fmt.Fprintln(flag.CommandLine.Output(), "huanyango-cli-demo -port=/dev/ttyUSB0")
-		fmt.Fprintln(flag.CommandLine.Output())
-		fmt.Fprintln(flag.CommandLine.Output(), "Use G-Codes M3, M4, M4 and Snnnn.")
-		fmt.Fprintln(flag.CommandLine.Output(), "? prints the current RPM.")
-		fmt.Fprintln(flag.CommandLine.Output(), "$ outputs if connected.")
+		fmt.Fprintln(flag.CommandLine.Output(), "tinyg-control -tinyg-port=/dev/ttyTinyg -port=/dev/ttyUSB0 [-config=tinyg-control.yaml]")
 		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "Serves the web interface for a TinyG controller with an optional spindle driver.")
+		fmt.Fprintln(flag.CommandLine.Output(), "Settings are read from the flag defaults, the YAML config file, the")
+		fmt.Fprintln(flag.CommandLine.Output(), "environment ("+envPrefix+"<FLAG>, e.g. "+envName("tinyg-port")+") and the")
+		fmt.Fprintln(flag.CommandLine.Output(), "command line, later sources override earlier ones. Use -print-config")
+		fmt.Fprintln(flag.CommandLine.Output(), "to show the resulting configuration as YAML.")
 		fmt.Fprintln(flag.CommandLine.Output())
 		flag.PrintDefaults()
 	}
-	var serialDevice *string = flag.String("port", "/dev/ttyMotorspindel", "USB Port. Linux default: /dev/ttyUSB0. On Windows use COMx, e.g. COM3. On Linux a symbolic link can be created using udev rules, see https://unix.stackexchange.com/a/183492.")
-	var pollRate *int64 = flag.Int64("interval", 750, "RPM status readout interval in milliseconds. Default: 750.")
-	var rpmHertzConversation *float64 = flag.Float64("rpm2hz", 3.47222, "Unit conversation from RPM to Hz. May be determined experimentally.")
-	var maxRpm *int64 = flag.Int64("maxrpm", 11520, "Maximum allowed RPM for your spindle.")
+	config := &TConfig{}
+	configFlags := config.bindFlags(flag.CommandLine)
+	var configFile *string = flag.String("config", os.Getenv(envName("config")), "YAML config file.")
+	var printConfig *bool = flag.Bool("print-config", false, "Print the configuration as YAML and exit.")
+	var doHashPassword *bool = flag.Bool("hash-password", false, "Read a password from stdin, print its hash for the users file and exit.")
+	var doNewToken *bool = flag.Bool("new-token", false, "Print a new API token and its hash for the users file and exit.")
 	flag.Parse()
 
-	var err error
+	if *doHashPassword || *doNewToken {
+		var err error
+		if *doHashPassword {
+			err = hashPassword(os.Stdin, os.Stdout)
+		} else {
+			err = newToken(os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err := config.load(flag.CommandLine, configFlags, *configFile)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		out, err := yaml.Marshal(config)
+		if err != nil {
+			panic(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	heightMapDir = config.Files.HeightMaps
+	if len(config.Auth.UsersFile) > 0 {
+		if auth, err = LoadAuth(config.Auth.UsersFile, config.Auth.SessionTimeout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	safeZ = config.Machine.SafeZ
+
 	tgHandle, err = tinyg.NewController()
 	if err != nil {
 		panic(err)
 	}
-	err = tgHandle.Open("/dev/ttyTinyg") // symbolic link to /dev/ttyUSBn, see https://unix.stackexchange.com/a/183492
-	defer tgHandle.Close()
+	tgHandle.RequireHomed = strings.ToUpper(config.Machine.RequireHomed)
+	tgHandle.Envelope = config.Envelope()
+	tgHandle.ToolChange = tinyg.TToolChangeSettings{
+		Enabled:       len(config.ToolChange.Position) > 0,
+		Position:      config.ToolChange.Position,
+		SafeZ:         safeZ,
+		ProbePosition: config.ToolChange.ProbePosition,
+		Probe:         tinyg.TProbeSettings{MaxDistance: config.ToolChange.ProbeDistance, Feed: config.ToolChange.ProbeFeed},
+	}
+	tgHandle.Positions, err = tinyg.LoadSavedPositions(config.Files.Positions)
 	if err != nil {
-		fmt.Println("Could not open serial port for Tinyg communction.")
+		fmt.Println("Could not load saved positions.")
 		panic(err)
 	}
-	tgHandle.VfdOutput = vfdio.NewVfd()
-	defer tgHandle.VfdOutput.Close()
+	tgHandle.Tools, err = tinyg.LoadToolTable(config.Files.Tools)
+	if err != nil {
+		fmt.Println("Could not load tool table.")
+		panic(err)
+	}
+	library, err = NewLibrary(config.Files.Library, config.Machine.RapidFeed)
+	if err != nil {
+		fmt.Println("Could not open file library.")
+		panic(err)
+	}
+	jobHistory, err = OpenJobHistory(config.Files.JobHistory)
+	if err != nil {
+		fmt.Println("Could not open job history.")
+		panic(err)
+	}
+	if lastId, err := jobHistory.LastId(); err == nil {
+		tgHandle.ContinueJobIds(lastId)
+	}
+	tgHandle.JobFinished = func(job tinyg.TJob) {
+		if err := jobHistory.Append(job); err != nil {
+			glog.Errorln("Could not save job #", job.Id, ": ", err)
+		}
+	}
+	// Open stops the spindle and starts its monitor, it has to be set first
+	spindleDriver = config.Spindle.Driver
+	tgHandle.Spindle, err = config.OpenSpindle()
+	if err != nil {
+		fmt.Println("Could not open spindle driver.")
+		panic(err)
+	}
+	if tgHandle.Spindle != nil {
+		defer tgHandle.Spindle.Close()
+	}
+	tgHandle.SpindleAtSpeedTimeout = config.Spindle.AtSpeedTimeout
+	tgHandle.SpindleStallPercent = config.Spindle.StallPercent
+	err = tgHandle.Open(config.TinygPort)
+	defer tgHandle.Close()
 	if err != nil {
-		fmt.Println("Could not open serial port for VFD communication.")
+		fmt.Println("Could not open serial port for Tinyg communction.")
 		panic(err)
 	}
-	tgHandle.VfdOutput.Open(*serialDevice, uint16(*maxRpm), *rpmHertzConversation, *pollRate)
 
-	http.HandleFunc("/api/", apiHome)
-	http.HandleFunc("/api/state", apiState)
-	http.HandleFunc("/api/exit", apiExit)
-	http.HandleFunc("/api/gcode", apiGcode)
-	http.HandleFunc("/api/file", apiGCodeFile)
-	http.HandleFunc("/api/halt", apiHalt)
-	http.HandleFunc("/api/continue", apiContinue)
-	http.HandleFunc("/api/stop", apiStop)
-	http.HandleFunc("/api/reset", apiReset)
-	http.HandleFunc("/api/vfd", apiSpindle)
+	registerApiV1(http.DefaultServeMux)
+	controlLock = NewControlLock(config.Auth.ControlTimeout, eventHub)
+	go forwardAlarms()
 
-	fs := http.FileServer(http.Dir("static"))
+	fs := http.FileServer(staticFileSystem(config.StaticDir))
 	http.Handle("/", fs)
 
-	fmt.Println("Starting Webserver...")
-	glog.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-func apiHome(w http.ResponseWriter, req *http.Request) {
-	fmt.Fprintf(w, "Api home. Use /api/state.")
+	handler := auth.Handler(controlLock.Handler(http.DefaultServeMux))
+	if config.Tls.Enabled {
+		certFile, keyFile := config.TlsFiles(*configFile)
+		generated, err := ensureCertificate(certFile, keyFile, localHosts())
+		if err != nil {
+			fmt.Println("Could not create TLS certificate.")
+			panic(err)
+		}
+		if generated {
+			fmt.Println("Generated self-signed certificate", certFile)
+		}
+		fingerprint, err := certificateFingerprint(certFile)
+		if err != nil {
+			fmt.Println("Could not read TLS certificate.")
+			panic(err)
+		}
+		fmt.Println("Starting Webserver with TLS on", config.Listen, "...")
+		fmt.Println("Certificate SHA-256 fingerprint:", fingerprint)
+		glog.Fatal(http.ListenAndServeTLS(config.Listen, certFile, keyFile, handler))
+	}
+	fmt.Println("Starting Webserver on", config.Listen, "...")
+	glog.Fatal(http.ListenAndServe(config.Listen, handler))
 }
 
-func apiExit(w http.ResponseWriter, req *http.Request) {
-	os.Exit(0)
+// forwardAlarms pushes alarms to the event streams.
+func forwardAlarms() {
+	alarms, _ := tgHandle.SubscribeAlarms()
+	for alarm := range alarms {
+		eventHub.Publish("alarm", alarm)
+	}
 }
 
-func apiGcode(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
+// spindleStatus returns the spindle driver and its speed, -1 if unknown.
+func spindleStatus() map[string]interface{} {
+	values := make(map[string]interface{})
+	values["driver"] = spindleDriver
+	values["f_set"] = -1
+	values["f_is"] = -1
+	values["rpm"] = -1
+	values["dir"] = 0
 
-	cmd, _ := url.QueryUnescape(req.URL.RawQuery)
-	tgHandle.Write(cmd)
-	fmt.Fprintf(w, `{"ok": true}`)
+	if tgHandle.Spindle != nil {
+		_, dir := tgHandle.Spindle.Setpoint()
+		values["rpm"] = int(tgHandle.Spindle.ActualRpm())
+		values["dir"] = int(dir)
+		if vfd, ok := tgHandle.Spindle.(*spindle.THuanyang); ok {
+			values["f_is"] = int(vfd.OutputFrequency())
+			values["f_set"] = int(vfd.FrequencySet())
+		}
+	}
+	return values
 }
 
-func apiHalt(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-
-	tgHandle.FeedHold()
-	fmt.Fprintf(w, `{"ok": true}`)
+func homedStatus() map[string]interface{} {
+	values := make(map[string]interface{})
+	values["homed"] = tgHandle.HomedAxes()
+	values["missing"] = tgHandle.MissingHomedAxes()
+	return values
 }
 
-func apiContinue(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-
-	tgHandle.FeedResume()
-	fmt.Fprintf(w, `{"ok": true}`)
+func toolsStatus() map[string]interface{} {
+	active, appliedLength := tgHandle.Tools.Active()
+	values := make(map[string]interface{})
+	values["tools"] = tgHandle.Tools.Tools()
+	values["active"] = active
+	values["appliedLength"] = appliedLength
+	return values
 }
 
-func apiStop(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-
-	tgHandle.Flush()
-	fmt.Fprintf(w, `{"ok": true}`)
+// currentHeightMap returns the last probed or loaded height map.
+func currentHeightMap() *tinyg.THeightMap {
+	lastHeightMapLock.Lock()
+	defer lastHeightMapLock.Unlock()
+	return lastHeightMap
 }
 
-func apiReset(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	tgHandle.TinygReset()
-	fmt.Fprintf(w, `{"ok": true}`)
+func setCurrentHeightMap(heightMap *tinyg.THeightMap) {
+	lastHeightMapLock.Lock()
+	defer lastHeightMapLock.Unlock()
+	lastHeightMap = heightMap
 }
 
-func apiState(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Write(tgHandle.StateJson())
+func heightMapStatus() map[string]interface{} {
+	values := make(map[string]interface{})
+	values["enabled"] = tgHandle.HeightMap() != nil
+	values["map"] = currentHeightMap()
+	return values
 }
 
-func apiGCodeFile(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-
-	req.ParseForm()
-
-	gcodes := strings.Split(req.Form.Get("gcode"), "\n")
-	for n, gcode := range gcodes {
-		glog.Infoln("Received GCode Line #", n, ": ", gcode)
+// enableHeightMap activates the last probed or loaded height map.
+func enableHeightMap(on bool) error {
+	if !on {
+		tgHandle.SetHeightMap(nil)
+		return nil
 	}
-	tgHandle.WriteLines(gcodes)
-
-	fmt.Fprintf(w, `{"ok": true}`)
+	heightMap := currentHeightMap()
+	if heightMap == nil {
+		return errNoHeightMap
+	}
+	tgHandle.SetHeightMap(heightMap)
+	return nil
 }
 
-func apiSpindle(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-
-	values := make(map[string]int)
-	values["f_set"] = -1
-	values["f_is"] = -1
-	values["rpm"] = -1
-	values["dir"] = 0
+// heightMapPath returns the storage path for a height map name.
+func heightMapPath(name string) string {
+	return filepath.Join(heightMapDir, filepath.Base(name)+".json")
+}
 
-	if tgHandle.VfdOutput != nil {
-		values["rpm"] = int(tgHandle.VfdOutput.OutputRpm())
-		values["f_is"] = int(tgHandle.VfdOutput.OutputFrequency())
-		values["f_set"] = int(tgHandle.VfdOutput.FrequencySet())
-		values["dir"] = int(tgHandle.VfdOutput.DirectionSet())
+func saveHeightMap(name string) error {
+	heightMap := currentHeightMap()
+	if heightMap == nil {
+		return errNoHeightMap
 	}
-
-	jsonBytes, err := json.Marshal(values)
-	if err != nil {
-		panic(err)
+	if err := os.MkdirAll(heightMapDir, 0755); err != nil {
+		return err
 	}
-	w.Write(jsonBytes)
+	return heightMap.Save(heightMapPath(name))
 }
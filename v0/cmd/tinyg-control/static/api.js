@@ -0,0 +1,32 @@
+// Requests to the versioned API. The callback receives the error message
+// or null and the decoded response, which is null for empty answers.
+function apiErrorMessage(xhr) {
+	try {
+		var data = JSON.parse(xhr.responseText);
+		if (data && data.error) {
+			return data.error.message;
+		}
+	} catch (e) {
+	}
+	return 'Request failed';
+}
+
+function api(method, path, body, callback) {
+	return $.ajax({
+		url: '/api/v1' + path,
+		method: method,
+		contentType: 'application/json',
+		data: body == null ? null : JSON.stringify(body),
+		dataType: 'text', // 202 and 204 answers have no body
+		success: function(text) {
+			if (callback) {
+				callback(null, text ? JSON.parse(text) : null);
+			}
+		},
+		error: function(xhr) {
+			if (callback) {
+				callback(apiErrorMessage(xhr), null);
+			}
+		}
+	});
+}
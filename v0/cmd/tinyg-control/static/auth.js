@@ -0,0 +1,30 @@
+// Logged in user. Pages return to the login when the session has expired,
+// viewers only see the machine state.
+var authIdentity = null;
+
+function authLogout() {
+	$.post('/api/v1/logout', function() {
+		window.location = 'login.html';
+	});
+	return false;
+}
+
+function authInit() {
+	$(document).ajaxError(function(event, xhr) {
+		if (xhr.status == 401) {
+			window.location = 'login.html';
+		}
+	});
+	$.getJSON('/api/v1/whoami', function(data) {
+		authIdentity = data;
+		if (!data.authEnabled) {
+			return;
+		}
+		$('#AuthUser').text(data.name + ' (' + data.role + ')');
+		$('#AuthPanel').show();
+		if (data.role == 'viewer') {
+			$('body').addClass('viewer');
+			$('button, input, select, textarea').not('.auth').prop('disabled', true);
+		}
+	});
+}
@@ -0,0 +1,90 @@
+// Serial console: raw TinyG traffic and sending commands with history.
+var consoleMaxLines = 1000;
+var consoleSource = null;
+var consoleLastId = 0;
+var consoleHistory = [];
+var consoleHistoryPos = 0;
+
+function consoleShow(line) {
+	if (line.id <= consoleLastId || $('#ConsolePause').prop('checked')) {
+		return;
+	}
+	consoleLastId = line.id;
+	var view = $('#ConsoleLines');
+	var atBottom = view.scrollTop() + view.innerHeight() >= view[0].scrollHeight - 5;
+	var row = $('<div>').addClass(line.dir);
+	row.append($('<span class="time">').text(new Date(line.time).toLocaleTimeString()));
+	row.append($('<span class="dir">').text(line.dir == 'tx' ? '>' : '<'));
+	row.append($('<span>').text(line.text));
+	view.append(row);
+	var rows = view.children();
+	if (rows.length > consoleMaxLines) {
+		rows.slice(0, rows.length - consoleMaxLines).remove();
+	}
+	if (atBottom) {
+		view.scrollTop(view[0].scrollHeight);
+	}
+}
+
+// consoleConnect (re)opens the stream, which starts with the buffered lines.
+function consoleConnect() {
+	if (consoleSource) {
+		consoleSource.close();
+	}
+	$('#ConsoleLines').empty();
+	consoleLastId = 0;
+	var polls = $('#ConsolePolls').prop('checked');
+	consoleSource = new EventSource('/api/v1/console/stream' + (polls ? '?polls=true' : ''));
+	consoleSource.addEventListener('line', function(event) {
+		consoleShow(JSON.parse(event.data));
+	});
+}
+
+function consoleLoadHistory() {
+	$.getJSON('/api/v1/console/history', function(lines) {
+		consoleHistory = lines;
+		consoleHistoryPos = lines.length;
+	});
+}
+
+function consoleSend() {
+	var line = $('#ConsoleInput').val();
+	if (!line.trim()) {
+		return false;
+	}
+	$.ajax({
+		url: '/api/v1/console',
+		method: 'POST',
+		contentType: 'application/json',
+		data: JSON.stringify({line: line}),
+		success: function() {
+			$('#ConsoleError').text('');
+			$('#ConsoleInput').val('');
+			consoleLoadHistory();
+		},
+		error: function(xhr) {
+			var data = xhr.responseJSON;
+			$('#ConsoleError').text(data && data.error ? data.error.message : 'Request failed');
+		}
+	});
+	return false;
+}
+
+// consoleKey recalls previous commands with the arrow keys.
+function consoleKey(event) {
+	if (event.key == 'ArrowUp' && consoleHistoryPos > 0) {
+		consoleHistoryPos--;
+	} else if (event.key == 'ArrowDown' && consoleHistoryPos < consoleHistory.length) {
+		consoleHistoryPos++;
+	} else {
+		return;
+	}
+	$('#ConsoleInput').val(consoleHistory[consoleHistoryPos] || '');
+	event.preventDefault();
+}
+
+function consoleInit() {
+	$('#ConsoleInput').on('keydown', consoleKey);
+	consoleLoadHistory();
+	consoleConnect();
+}
@@ -0,0 +1,92 @@
+// Control lock: one browser tab controls the machine, the others observe.
+// The lock state is pushed by the server as "control" event. The server
+// issues a token to the holder, it is sent back with every request.
+var controlToken = null;
+var controlState = {held: false};
+
+function controlSetToken(token) {
+	controlToken = token;
+	sessionStorage.setItem('controlToken', token);
+	$.ajaxSetup({headers: {'X-Control-Token': token}});
+}
+
+if (sessionStorage.getItem('controlToken')) {
+	controlSetToken(sessionStorage.getItem('controlToken'));
+}
+
+$(document).ajaxComplete(function(event, xhr) {
+	var token = xhr.getResponseHeader('X-Control-Token');
+	if (token) {
+		controlSetToken(token);
+	}
+});
+
+function controlMine() {
+	return controlState.held && controlState.mine;
+}
+
+function controlShow(state) {
+	controlState = state;
+	var observer = state.held && !controlMine();
+	if (!state.held) {
+		$('#ControlHolder').text('free');
+	} else if (controlMine()) {
+		$('#ControlHolder').text('this window');
+	} else {
+		$('#ControlHolder').text((state.holder.user || 'another window') + ' since ' + new Date(state.holder.since).toLocaleTimeString());
+	}
+	$('#ControlRelease').toggle(controlMine());
+	$('#ControlAcquire').toggle(!controlMine());
+	$('body').toggleClass('observer', observer);
+	if (!$('body').hasClass('viewer')) {
+		$('button, input, select, textarea').not('.auth, .control').prop('disabled', observer);
+	}
+}
+
+function controlResult(xhr) {
+	var data = xhr.responseJSON;
+	$('#ControlError').text(data && data.error ? data.error.message : '');
+	if (data && data.token) {
+		controlSetToken(data.token);
+	}
+	if (data && data.held !== undefined) {
+		controlShow(data);
+	}
+}
+
+function controlAcquire() {
+	var force = false;
+	if (controlState.held && !controlMine()) {
+		if (!confirm('Take over control from ' + (controlState.holder.user || 'another window') + '?')) {
+			return false;
+		}
+		force = true;
+	}
+	$.ajax({
+		url: '/api/v1/control/acquire',
+		method: 'POST',
+		contentType: 'application/json',
+		data: JSON.stringify({force: force}),
+		complete: controlResult
+	});
+	return false;
+}
+
+function controlRelease() {
+	$.ajax({url: '/api/v1/control/release', method: 'POST', complete: controlResult});
+	return false;
+}
+
+// Events do not tell whether this window is the holder, it is asked for.
+function controlRefresh() {
+	api('GET', '/control', null, function(error, data) {
+		if (!error) {
+			controlShow(data);
+		}
+	});
+}
+
+function controlInit() {
+	var events = new EventSource('/api/v1/events');
+	events.addEventListener('control', controlRefresh);
+}
@@ -0,0 +1,116 @@
+// G-code file library: upload, analysis, rename, delete and run.
+function filesError(xhr) {
+	var data = xhr.responseJSON;
+	$('#FilesError').text(data && data.error ? data.error.message : 'Request failed');
+}
+
+function filesDuration(seconds) {
+	var minutes = Math.round(seconds / 60);
+	return Math.floor(minutes / 60) + 'h ' + ('0' + minutes % 60).slice(-2) + 'm';
+}
+
+function filesBox(analysis) {
+	var parts = [];
+	$.each('XYZ', function(axis, letter) {
+		if (analysis.bounded[axis]) {
+			parts.push(letter + ' ' + analysis.min[axis].toFixed(1) + '..' + analysis.max[axis].toFixed(1));
+		}
+	});
+	return parts.join(', ') + (analysis.inch ? ' in' : ' mm');
+}
+
+function filesRequest(method, url, body, done) {
+	$.ajax({
+		url: url,
+		method: method,
+		contentType: 'application/json',
+		data: body == null ? null : JSON.stringify(body),
+		success: function(data) {
+			$('#FilesError').text('');
+			if (done) {
+				done(data);
+			}
+			filesLoad();
+		},
+		error: filesError
+	});
+}
+
+function filesLoad() {
+	$.getJSON('/api/v1/files', function(files) {
+		var table = $('#FilesTable tbody').empty();
+		$.each(files, function(i, file) {
+			var row = $('<tr>');
+			row.append($('<td>').append($('<a>').attr('href', '/api/v1/files/content?name=' + encodeURIComponent(file.name)).text(file.name)));
+			row.append($('<td class="value">').text((file.size / 1024).toFixed(1) + ' kB'));
+			row.append($('<td class="value">').text(file.analysis.lines));
+			row.append($('<td>').text(filesBox(file.analysis)));
+			row.append($('<td class="value">').text(filesDuration(file.analysis.seconds)));
+			var actions = $('<td>');
+			actions.append($('<a href="#">').text('Run').on('click', function() {
+				if (confirm('Run ' + file.name + '?')) {
+					filesRequest('POST', '/api/v1/files/run', {name: file.name}, filesShowJob);
+				}
+				return false;
+			}));
+			actions.append(' ');
+			actions.append($('<a href="#">').text('Rename').on('click', function() {
+				var newName = prompt('New name', file.name);
+				if (newName && newName != file.name) {
+					filesRequest('POST', '/api/v1/files/rename', {name: file.name, newName: newName});
+				}
+				return false;
+			}));
+			actions.append(' ');
+			actions.append($('<a href="#">').text('Delete').on('click', function() {
+				if (confirm('Delete ' + file.name + '?')) {
+					filesRequest('DELETE', '/api/v1/files?name=' + encodeURIComponent(file.name), null);
+				}
+				return false;
+			}));
+			row.append(actions);
+			table.append(row);
+		});
+	});
+}
+
+var filesJobOutcome;
+
+function filesShowJob(job) {
+	if (filesJobOutcome == 'running' && job.outcome != 'running') {
+		historyLoad();
+	}
+	filesJobOutcome = job.outcome;
+	var text = job.name || '(program)';
+	text += ': ' + job.outcome + ', ' + job.linesDone + ' of ' + job.lines + ' lines';
+	$('#FilesJob').text(text);
+}
+
+function filesLoadJob() {
+	$.ajax({url: '/api/v1/job', dataType: 'json', success: filesShowJob, global: false});
+}
+
+function filesUpload() {
+	var data = new FormData($('#FilesUpload')[0]);
+	var overwrite = $('#FilesOverwrite').prop('checked');
+	$.ajax({
+		url: '/api/v1/files' + (overwrite ? '?overwrite=true' : ''),
+		method: 'POST',
+		data: data,
+		processData: false,
+		contentType: false,
+		success: function() {
+			$('#FilesError').text('');
+			$('#FilesUpload')[0].reset();
+			filesLoad();
+		},
+		error: filesError
+	});
+	return false;
+}
+
+function filesInit() {
+	filesLoad();
+	filesLoadJob();
+	window.setInterval(filesLoadJob, 2000);
+}
@@ -0,0 +1,44 @@
+// Job history with filter and CSV export.
+function historyQuery() {
+	var params = {};
+	$.each($('#HistoryFilter').serializeArray(), function(i, field) {
+		if (field.value) {
+			params[field.name] = field.value;
+		}
+	});
+	return params;
+}
+
+function historyOffsets(job) {
+	var parts = [];
+	$.each(job.offsets || {}, function(name, offset) {
+		parts.push(name + ' ' + [offset.x, offset.y, offset.z].join('/'));
+	});
+	return parts.join(', ');
+}
+
+function historyLoad() {
+	var params = historyQuery();
+	$('#HistoryCsv').attr('href', '/api/v1/jobs/history?' + $.param($.extend({format: 'csv'}, params)));
+	params.limit = 200;
+	$.getJSON('/api/v1/jobs/history', params, function(jobs) {
+		var table = $('#HistoryTable tbody').empty();
+		$.each(jobs, function(i, job) {
+			var row = $('<tr>');
+			row.append($('<td>').text(new Date(job.start).toLocaleString()));
+			row.append($('<td>').text(job.name || '(program)').attr('title', job.hash));
+			row.append($('<td class="value">').text(filesDuration((new Date(job.end) - new Date(job.start)) / 1000)));
+			row.append($('<td>').text(job.outcome));
+			row.append($('<td class="value">').text(job.linesDone + ' / ' + job.lines));
+			row.append($('<td>').text(historyOffsets(job)));
+			row.append($('<td>').text($.map(job.alarms || [], function(alarm) {
+				return alarm.msg;
+			}).join('; ')));
+			table.append(row);
+		});
+	});
+}
+
+function historyInit() {
+	historyLoad();
+}
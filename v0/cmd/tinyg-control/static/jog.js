@@ -0,0 +1,126 @@
+// Jogging by buttons, keyboard and gamepad.
+// Continuous jogs are kept alive by repeating the start request,
+// the server stops the move if the keep-alive is missing.
+var jogKeepAliveInterval = 200;
+var jogActive = null;
+var jogTimer = null;
+
+function jogFeed() {
+	return parseFloat($('#JogFeed').val());
+}
+
+function jogStep(axis, dir) {
+	var distance = dir * parseFloat($('#JogStep').val());
+	api('POST', '/jog', {axis: axis, distance: distance, feed: jogFeed()}, jogResult);
+}
+
+function jogStart(axis, dir) {
+	var key = axis + dir;
+	if (jogActive == key) {
+		return;
+	}
+	jogStop();
+	jogActive = key;
+	var request = function() {
+		api('POST', '/jog/start', {axis: axis, direction: dir, feed: jogFeed()}, jogResult);
+	};
+	request();
+	jogTimer = window.setInterval(request, jogKeepAliveInterval);
+}
+
+function jogStop() {
+	if (jogActive == null) {
+		return;
+	}
+	window.clearInterval(jogTimer);
+	jogActive = null;
+	api('POST', '/jog/stop', null, jogResult);
+}
+
+function jogResult(error) {
+	if (error) {
+		window.clearInterval(jogTimer);
+		jogActive = null;
+		$('#JogError').text(error);
+	} else {
+		$('#JogError').text('');
+	}
+}
+
+function jogButton(axis, dir) {
+	if ($('#JogContinuous').prop('checked')) {
+		jogStart(axis, dir);
+	} else {
+		jogStep(axis, dir);
+	}
+}
+
+var jogKeys = {
+	37: ['x', -1], // arrow left
+	39: ['x', 1],  // arrow right
+	38: ['y', 1],  // arrow up
+	40: ['y', -1], // arrow down
+	33: ['z', 1],  // page up
+	34: ['z', -1]  // page down
+};
+
+function jogInit() {
+	$('.jogButton').on('mousedown touchstart', function() {
+		jogButton($(this).data('axis'), $(this).data('dir'));
+		return false;
+	}).on('mouseup mouseleave touchend', function() {
+		if ($('#JogContinuous').prop('checked')) {
+			jogStop();
+		}
+	}).on('click', false);
+	$(document).on('keydown', function(e) {
+		var jog = jogKeys[e.keyCode];
+		if (jog == null || $(e.target).is('input, textarea')) {
+			return;
+		}
+		if ($('#JogContinuous').prop('checked')) {
+			jogStart(jog[0], jog[1]);
+		} else if (!e.originalEvent.repeat) {
+			jogStep(jog[0], jog[1]);
+		}
+		return false;
+	}).on('keyup', function(e) {
+		if (jogKeys[e.keyCode] != null) {
+			jogStop();
+		}
+	});
+	window.setInterval(jogPollGamepad, 100);
+}
+
+// jogPollGamepad maps the left stick to X/Y and the right stick to Z.
+function jogPollGamepad() {
+	if (!navigator.getGamepads) {
+		return;
+	}
+	var pads = navigator.getGamepads();
+	var pad = null;
+	for (var i = 0; i < pads.length; i++) {
+		if (pads[i] != null) {
+			pad = pads[i];
+			break;
+		}
+	}
+	if (pad == null) {
+		return;
+	}
+	var deadZone = 0.5;
+	var sticks = [['x', pad.axes[0]], ['y', -pad.axes[1]], ['z', -pad.axes[3]]];
+	for (var i = 0; i < sticks.length; i++) {
+		var value = sticks[i][1];
+		if (Math.abs(value) > deadZone) {
+			jogStart(sticks[i][0], value > 0 ? 1 : -1);
+			jogGamepadActive = true;
+			return;
+		}
+	}
+	if (jogGamepadActive) { // only stop jogs started by the gamepad
+		jogGamepadActive = false;
+		jogStop();
+	}
+}
+var jogGamepadActive = false;
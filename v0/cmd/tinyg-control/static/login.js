@@ -0,0 +1,20 @@
+// Login form, the session cookie is set by the server.
+function loginInit() {
+	$('#LoginForm').on('submit', function() {
+		$.ajax({
+			url: '/api/v1/login',
+			method: 'POST',
+			contentType: 'application/json',
+			data: JSON.stringify({name: $('#LoginName').val(), password: $('#LoginPassword').val()}),
+			success: function() {
+				window.location = 'index.html';
+			},
+			error: function(xhr) {
+				var data = xhr.responseJSON;
+				$('#LoginError').text(data && data.error ? data.error.message : 'Login failed');
+			}
+		});
+		return false;
+	});
+	$('#LoginName').focus();
+}
@@ -0,0 +1,36 @@
+// Feed, rapid and spindle overrides in percent.
+var overridesEditing = false;
+
+function overridesResult(error, overrides) {
+	$('#OverridesError').text(error || '');
+	overridesShow(overrides);
+}
+
+function overridesShow(overrides) {
+	if (overrides == null) {
+		return;
+	}
+	$('#DisplayOverrideFeed').text(overrides.feed);
+	$('#DisplayOverrideTraverse').text(overrides.traverse);
+	$('#DisplayOverrideSpindle').text(overrides.spindle);
+	if (!overridesEditing) { // do not move a slider while it is dragged
+		$('#OverrideFeed').val(overrides.feed);
+		$('#OverrideTraverse').val(overrides.traverse);
+		$('#OverrideSpindle').val(overrides.spindle);
+	}
+}
+
+function overridesReset() {
+	api('PATCH', '/overrides', {feed: 100, traverse: 100, spindle: 100}, overridesResult);
+}
+
+function overridesInit() {
+	$('input[data-override]').on('input', function() {
+		overridesEditing = true;
+	}).on('change', function() {
+		overridesEditing = false;
+		var body = {};
+		body[$(this).data('override')] = parseFloat($(this).val());
+		api('PATCH', '/overrides', body, overridesResult);
+	});
+}
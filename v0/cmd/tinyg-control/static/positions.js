@@ -0,0 +1,43 @@
+// Named positions: one button per position moves there safely.
+function positionsResult(error) {
+	$('#PositionsError').text(error || '');
+	positionsLoad(false);
+}
+
+function positionsLoad(refresh) {
+	api('GET', '/positions' + (refresh ? '?refresh=true' : ''), null, function(error, positions) {
+		if (error) {
+			return;
+		}
+		var list = $('#PositionsList').empty();
+		$.each(Object.keys(positions).sort(), function(i, name) {
+			var pos = positions[name];
+			var title = 'X' + pos.x.toFixed(3) + ' Y' + pos.y.toFixed(3) + ' Z' + pos.z.toFixed(3);
+			var entry = $('<span class="position">');
+			entry.append($('<a href="#">').text(name).attr('title', title).on('click', function() {
+				if (confirm('Move to ' + name + ' (' + title + ')?')) {
+					api('POST', '/positions/goto', {name: name}, positionsResult);
+				}
+				return false;
+			}));
+			if (name != 'g28' && name != 'g30') {
+				entry.append($('<a href="#">').text('x').on('click', function() {
+					if (confirm('Delete ' + name + '?')) {
+						api('DELETE', '/positions?name=' + encodeURIComponent(name), null, positionsResult);
+					}
+					return false;
+				}));
+			}
+			list.append(entry);
+		});
+	});
+}
+
+function positionsSave() {
+	var name = $('#PositionName').val();
+	api('POST', '/positions', {name: name}, positionsResult);
+}
+
+function positionsInit() {
+	positionsLoad(true);
+}
@@ -0,0 +1,58 @@
+// Tool table: length offsets are applied by the controller on M6, G43 or select.
+function toolsResult(error) {
+	$('#ToolsError').text(error || '');
+	toolsLoad();
+}
+
+function toolsLoad() {
+	api('GET', '/tools', null, function(error, data) {
+		if (error) {
+			return;
+		}
+		var table = $('#ToolsTable tbody').empty();
+		$('#DisplayActiveTool').text(data.active);
+		$.each(data.tools, function(i, tool) {
+			var row = $('<tr>').toggleClass('active', tool.number == data.active);
+			row.append($('<td>').text('T' + tool.number));
+			row.append($('<td>').text(tool.description));
+			row.append($('<td>').text(tool.diameter.toFixed(3)));
+			row.append($('<td>').text(tool.lengthOffset.toFixed(3)));
+			var actions = $('<td>');
+			actions.append($('<a href="#">').text('Select').on('click', function() {
+				api('POST', '/tools/select', {number: tool.number}, toolsResult);
+				return false;
+			}));
+			actions.append(' ');
+			actions.append($('<a href="#">').text('Edit').on('click', function() {
+				$('#ToolNumber').val(tool.number);
+				$('#ToolDescription').val(tool.description);
+				$('#ToolDiameter').val(tool.diameter);
+				$('#ToolLength').val(tool.lengthOffset);
+				return false;
+			}));
+			actions.append(' ');
+			actions.append($('<a href="#">').text('x').on('click', function() {
+				if (confirm('Delete T' + tool.number + '?')) {
+					api('DELETE', '/tools?number=' + tool.number, null, toolsResult);
+				}
+				return false;
+			}));
+			row.append(actions);
+			table.append(row);
+		});
+	});
+}
+
+function toolsSave() {
+	var tool = {
+		number: parseInt($('#ToolNumber').val(), 10),
+		description: $('#ToolDescription').val(),
+		diameter: parseFloat($('#ToolDiameter').val()) || 0,
+		lengthOffset: parseFloat($('#ToolLength').val()) || 0
+	};
+	api('PUT', '/tools', tool, toolsResult);
+}
+
+function toolsInit() {
+	toolsLoad();
+}
@@ -0,0 +1,71 @@
+// Work coordinate system panel: lists G54 to G59 and G92,
+// allows selecting, editing and zeroing.
+var wcsSystems = ['G54', 'G55', 'G56', 'G57', 'G58', 'G59', 'G92'];
+
+function wcsResult(error) {
+	$('#WcsError').text(error || '');
+	wcsLoad(false);
+}
+
+function wcsLoad(refresh) {
+	api('GET', '/wcs' + (refresh ? '?refresh=true' : ''), null, function(error, offsets) {
+		if (error) {
+			return;
+		}
+		$.each(wcsSystems, function(i, cs) {
+			var offset = offsets[cs];
+			if (offset == null) {
+				return;
+			}
+			var row = $('#Wcs' + cs);
+			$.each(['x', 'y', 'z'], function(j, axis) {
+				var input = row.find('input[data-axis=' + axis + ']');
+				if (!input.is(':focus')) {
+					input.val(parseFloat(offset[axis]).toFixed(3));
+				}
+			});
+		});
+	});
+}
+
+function wcsSet(cs) {
+	var row = $('#Wcs' + cs);
+	var axes = {};
+	row.find('input').each(function() {
+		if ($(this).val() !== '') {
+			axes[$(this).data('axis')] = parseFloat($(this).val());
+		}
+	});
+	api('PUT', '/wcs/offset', {cs: cs, axes: axes}, wcsResult);
+}
+
+function wcsInit() {
+	var table = $('#WcsTable');
+	$.each(wcsSystems, function(i, cs) {
+		var row = $('<tr>').attr('id', 'Wcs' + cs).append($('<th>').text(cs));
+		$.each(['x', 'y', 'z'], function(j, axis) {
+			var input = $('<input type="number" step="any" class="value">').attr('data-axis', axis);
+			if (cs == 'G92') {
+				input.prop('readonly', true);
+			}
+			row.append($('<td>').append(input));
+		});
+		if (cs != 'G92') {
+			row.append($('<td>').append($('<a href="#">').text('Set').on('click', function() {
+				wcsSet(cs);
+				return false;
+			})));
+			row.append($('<td>').append($('<a href="#">').text('Select').on('click', function() {
+				api('POST', '/wcs/select', {cs: cs}, wcsResult);
+				return false;
+			})));
+		}
+		table.append(row);
+	});
+	wcsLoad(true);
+	window.setInterval(function() { wcsLoad(false); }, 2000);
+}
+
+function wcsZero(axis) {
+	api('POST', '/wcs/zero', {axis: axis}, wcsResult);
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"github.com/golang/glog"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"time"
+)
+
+const (
+	alarmLogLength         int = 100
+	alarmSubscriberBacklog int = 16
+)
+
+var (
+	ErrNoSuchAlarm          = errors.New("no such alarm")
+	ErrAlarmNotAcknowledged = errors.New("alarm has not been acknowledged")
+)
+
+// TAlarmEvent is an entry of the alarm log. It is created for every
+// exception report received from TinyG.
+type TAlarmEvent struct {
+	Id           int                        `json:"id"`
+	Time         time.Time                  `json:"time"`
+	Status       tgjson.TResponseStatusCode `json:"st"`
+	Message      string                     `json:"msg"`
+	Acknowledged bool                       `json:"ack"`
+}
+
+func (o *TinygController) recordAlarm(status tgjson.TResponseStatusCode, msg string) {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	o.alarmSeq++
+	event := TAlarmEvent{
+		Id:      o.alarmSeq,
+		Time:    time.Now(),
+		Status:  status,
+		Message: msg,
+	}
+	glog.Warningln("Alarm #", event.Id, ": ", status, msg)
+	o.alarmLog = append(o.alarmLog, event)
+	if len(o.alarmLog) > alarmLogLength {
+		o.alarmLog = o.alarmLog[len(o.alarmLog)-alarmLogLength:]
+	}
+	switch status {
+	case tgjson.StatusAlarmed, tgjson.StatusLimitSwitchHit:
+		o.resetHomed() // machine position is lost
+	}
+	for subscriber := range o.alarmSubscribers {
+		select {
+		case subscriber <- event:
+		default: // never block the receiver on a slow subscriber
+		}
+	}
+}
+
+// lastAlarmId returns the id of the newest alarm or 0.
+func (o *TinygController) lastAlarmId() int {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	return o.alarmSeq
+}
+
+// Alarms returns a copy of the alarm log with all events newer than
+// the event with id since. Use 0 for the full log.
+func (o *TinygController) Alarms(since int) (events []TAlarmEvent) {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	events = make([]TAlarmEvent, 0, len(o.alarmLog))
+	for _, event := range o.alarmLog {
+		if event.Id > since {
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+// Alarmed returns true if there is at least one alarm that has not
+// been acknowledged yet.
+func (o *TinygController) Alarmed() bool {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	for _, event := range o.alarmLog {
+		if !event.Acknowledged {
+			return true
+		}
+	}
+	return false
+}
+
+// AcknowledgeAlarm marks the alarm with the given id as seen by the operator.
+// An id of 0 acknowledges all alarms.
+func (o *TinygController) AcknowledgeAlarm(id int) error {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	found := false
+	for n := range o.alarmLog {
+		if id == 0 || o.alarmLog[n].Id == id {
+			o.alarmLog[n].Acknowledged = true
+			found = true
+		}
+	}
+	if !found && id != 0 {
+		return ErrNoSuchAlarm
+	}
+	return nil
+}
+
+// ClearAlarms sends the clear command to TinyG. It is refused
+// until all alarms have been acknowledged.
+func (o *TinygController) ClearAlarms() error {
+	if o.Alarmed() {
+		return ErrAlarmNotAcknowledged
+	}
+	o.writeDirect(tgjson.CommandClearAlarm)
+	return nil
+}
+
+// SubscribeAlarms returns a channel which receives all new alarm events.
+// The returned function has to be called to unsubscribe.
+func (o *TinygController) SubscribeAlarms() (events <-chan TAlarmEvent, cancel func()) {
+	o.alarmLock.Lock()
+	defer o.alarmLock.Unlock()
+	subscriber := make(chan TAlarmEvent, alarmSubscriberBacklog)
+	if o.alarmSubscribers == nil {
+		o.alarmSubscribers = make(map[chan TAlarmEvent]bool)
+	}
+	o.alarmSubscribers[subscriber] = true
+	cancel = func() {
+		o.alarmLock.Lock()
+		defer o.alarmLock.Unlock()
+		delete(o.alarmSubscribers, subscriber)
+	}
+	return subscriber, cancel
+}
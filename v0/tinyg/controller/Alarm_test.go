@@ -0,0 +1,24 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"testing"
+)
+
+func TestClearAlarms(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	tg.recordAlarm(tgjson.StatusLimitSwitchHit, "")
+	if err := tg.ClearAlarms(); err != ErrAlarmNotAcknowledged {
+		t.Error("Cleared without acknowledge: ", err)
+	}
+	tg.AcknowledgeAlarm(0)
+	if err := tg.ClearAlarms(); err != nil {
+		t.Fatal(err)
+	}
+	// TinyG answers the clear command like any other line
+	tg.ackLock.Lock()
+	defer tg.ackLock.Unlock()
+	if written := port.Written(); len(written) != 1 || written[0] != tgjson.CommandClearAlarm || len(tg.pendingAcks) != 1 {
+		t.Error("Clear command not waiting for its answer: ", written, tg.pendingAcks)
+	}
+}
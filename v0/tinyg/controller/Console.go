@@ -0,0 +1,218 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	consoleLength            int = 2000
+	consoleSubscriberBacklog int = 256
+)
+
+var ErrEmptyConsoleLine = errors.New("empty command")
+
+// TConsoleDirection tells whether a line was sent to or received from TinyG.
+type TConsoleDirection string
+
+const (
+	ConsoleTx TConsoleDirection = "tx"
+	ConsoleRx TConsoleDirection = "rx"
+)
+
+// TConsoleLine is an entry of the serial console.
+type TConsoleLine struct {
+	Id   int               `json:"id"`
+	Time time.Time         `json:"time"`
+	Dir  TConsoleDirection `json:"dir"`
+	Text string            `json:"text"`
+	// Poll marks the periodic state requests and their responses
+	Poll bool `json:"poll"`
+}
+
+// pollKeys are requested periodically by statePolling. Status reports
+// are sent by TinyG on its own.
+var pollKeys = map[string]bool{
+	"mpo": true, "pos": true, "sr": true, "g92": true,
+	"g54": true, "g55": true, "g56": true, "g57": true, "g58": true, "g59": true,
+}
+
+// readRequest matches JSON requests which only read a value, like {sr:n}
+// or {"fv":null}.
+var readRequest = regexp.MustCompile(`^\{\s*"?[a-zA-Z0-9]+"?\s*:\s*(n|null)\s*\}$`)
+
+// IsSetting returns true for console lines which may change the settings
+// of TinyG: JSON commands other than reads and text mode lines like
+// $xvm=1000.
+func IsSetting(line string) bool {
+	line = strings.TrimSpace(line)
+	if gcode.IsJson(line) {
+		return !readRequest.MatchString(line)
+	}
+	return strings.HasPrefix(line, "$") && strings.Contains(line, "=")
+}
+
+// isPoll returns true for polling requests like {mpo:n} and the responses
+// which contain nothing but polled values.
+func isPoll(dir TConsoleDirection, text string) bool {
+	if dir == ConsoleTx {
+		return strings.HasPrefix(text, "{") && strings.HasSuffix(text, ":n}") &&
+			pollKeys[text[1:len(text)-3]]
+	}
+	var response struct {
+		R  map[string]json.RawMessage `json:"r"`
+		Sr json.RawMessage            `json:"sr"`
+	}
+	if json.Unmarshal([]byte(text), &response) != nil {
+		return false
+	}
+	if response.R == nil {
+		return response.Sr != nil
+	}
+	if len(response.R) == 0 {
+		return false
+	}
+	for key := range response.R {
+		if !pollKeys[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// consoleText removes the line feed and shows control characters like ^X.
+func consoleText(data string) string {
+	data = strings.TrimRight(data, "\r\n")
+	var out strings.Builder
+	for n := 0; n < len(data); n++ {
+		if c := data[n]; c < ' ' {
+			out.WriteString("^" + string('@'+c)) // 0x04 is shown as ^D
+		} else {
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+func (o *TinygController) recordConsole(dir TConsoleDirection, data string) {
+	text := consoleText(data)
+	poll := isPoll(dir, text)
+	o.consoleLock.Lock()
+	defer o.consoleLock.Unlock()
+	o.consoleSeq++
+	line := TConsoleLine{Id: o.consoleSeq, Time: time.Now(), Dir: dir, Text: text, Poll: poll}
+	if len(o.console) < consoleLength {
+		o.console = append(o.console, line)
+	} else {
+		o.console[(o.consoleSeq-1)%consoleLength] = line
+	}
+	for subscriber := range o.consoleSubscribers {
+		select {
+		case subscriber <- line:
+		default: // never block the serial loops on a slow subscriber
+		}
+	}
+}
+
+// portWrite sends data to TinyG and records it in the console.
+func (o *TinygController) portWrite(data []byte) {
+	o.writeLock.Lock()
+	defer o.writeLock.Unlock()
+	o.port.Write(data)
+	o.recordConsole(ConsoleTx, string(data))
+}
+
+// portWriteLine writes a line which TinyG answers. Answers arrive in the
+// order of the lines, ack is handled by the answer of this line.
+func (o *TinygController) portWriteLine(cmd string, ack tPendingAck) {
+	o.writeLock.Lock()
+	defer o.writeLock.Unlock()
+	o.ackLock.Lock()
+	o.pendingAcks = append(o.pendingAcks, ack)
+	o.ackLock.Unlock()
+	data := cmd + "\n"
+	o.port.Write([]byte(data))
+	o.recordConsole(ConsoleTx, data)
+}
+
+// Console returns the buffered lines newer than the line with id since,
+// oldest first. Polling requests and responses are left out unless polls
+// is set.
+func (o *TinygController) Console(since int, polls bool) (lines []TConsoleLine) {
+	o.consoleLock.Lock()
+	defer o.consoleLock.Unlock()
+	lines = make([]TConsoleLine, 0, len(o.console))
+	start := 0
+	if len(o.console) == consoleLength {
+		start = o.consoleSeq % consoleLength
+	}
+	for n := range o.console {
+		line := o.console[(start+n)%len(o.console)]
+		if line.Id > since && (polls || !line.Poll) {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+// SubscribeConsole returns a channel which receives all new console lines.
+// The returned function has to be called to unsubscribe.
+func (o *TinygController) SubscribeConsole() (lines <-chan TConsoleLine, cancel func()) {
+	o.consoleLock.Lock()
+	defer o.consoleLock.Unlock()
+	subscriber := make(chan TConsoleLine, consoleSubscriberBacklog)
+	if o.consoleSubscribers == nil {
+		o.consoleSubscribers = make(map[chan TConsoleLine]bool)
+	}
+	o.consoleSubscribers[subscriber] = true
+	cancel = func() {
+		o.consoleLock.Lock()
+		defer o.consoleLock.Unlock()
+		delete(o.consoleSubscribers, subscriber)
+	}
+	return subscriber, cancel
+}
+
+// SendConsole sends a line typed by the operator. JSON commands and the
+// single character commands like ! are sent at once. While a job is
+// running only the single character commands and JSON reads like {sr:n}
+// are accepted, settings and G-code are refused.
+func (o *TinygController) SendConsole(line string) error {
+	line = strings.TrimSpace(line)
+	switch {
+	case len(line) == 0:
+		return ErrEmptyConsoleLine
+	case line == tgjson.CommandFeedHold || line == tgjson.CommandFeedResume || line == tgjson.CommandQueueFlush:
+		o.portWrite([]byte(line))
+	case readRequest.MatchString(line):
+		o.writeDirect(line)
+	case o.JobRunning():
+		return ErrJobRunning
+	case gcode.IsJson(line):
+		o.writeDirect(line)
+	default:
+		o.Write(line)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestConsolePolls(t *testing.T) {
+	polls := map[string]bool{
+		"{mpo:n}":                               true,
+		"{g55:n}":                               true,
+		"{fv:n}":                                false,
+		"G0 X1":                                 false,
+		`{"sr":{"posx":1.000}}`:                 true,
+		`{"r":{"mpo":{"x":1}},"f":[1,0,8]}`:     true,
+		`{"r":{"fv":0.970},"f":[1,0,8]}`:        false,
+		`{"r":{},"f":[1,0,8]}`:                  false,
+		`{"er":{"fb":440.2,"st":204,"msg":""}}`: false,
+	}
+	for text, poll := range polls {
+		dir := ConsoleRx
+		if text[0] != '{' || text[1] != '"' {
+			dir = ConsoleTx
+		}
+		if isPoll(dir, text) != poll {
+			t.Errorf("Poll of %q should be %v", text, poll)
+		}
+	}
+	if text := consoleText("\x18!\n"); text != "^X!" {
+		t.Error("Wrong console text: ", text)
+	}
+}
+
+func TestConsoleRingBuffer(t *testing.T) {
+	tg, _ := NewController()
+	for n := 0; n < consoleLength+10; n++ {
+		tg.recordConsole(ConsoleTx, "{sr:n}")
+		tg.recordConsole(ConsoleTx, "G0 X1\n")
+	}
+	lines := tg.Console(0, true)
+	if len(lines) != consoleLength || lines[0].Id != consoleLength+21 || lines[len(lines)-1].Id != 2*consoleLength+20 {
+		t.Error("Wrong buffered lines: ", len(lines), lines[0].Id)
+	}
+	lines = tg.Console(2*consoleLength+10, false)
+	if len(lines) != 5 || lines[0].Text != "G0 X1" || lines[0].Poll {
+		t.Error("Wrong lines without polls: ", lines)
+	}
+}
+
+func TestConsoleDuringJob(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	atomic.StoreInt32(&tg.jobActive, 1)
+	cases := []struct {
+		line string
+		err  error
+	}{
+		{"{sr:n}", nil},
+		{`{"fv": null}`, nil},
+		{"!", nil},
+		{`{"xvm":1000}`, ErrJobRunning},
+		{"{sr:{posx:t}}", ErrJobRunning},
+		{"G0 X1", ErrJobRunning},
+		{" ", ErrEmptyConsoleLine},
+	}
+	for _, c := range cases {
+		if err := tg.SendConsole(c.line); err != c.err {
+			t.Errorf("%q: %v instead of %v", c.line, err, c.err)
+		}
+	}
+	if written := port.Written(); len(written) != 3 || written[1] != `{"fv": null}` {
+		t.Error("Wrong lines sent: ", written)
+	}
+	atomic.StoreInt32(&tg.jobActive, 0)
+	if err := tg.SendConsole(`{"xvm":1000}`); err != nil {
+		t.Error("Setting refused without job: ", err)
+	}
+}
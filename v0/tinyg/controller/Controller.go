@@ -18,9 +18,11 @@ package controller
 
 import (
 	"bufio"
+	"encoding/json"
 	"github.com/golang/glog"
-	"github.com/itschleemilch/huanyango/v1/vfdio"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
 	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
 	"github.com/jacobsa/go-serial/serial"
 	"io"
 	"strings"
@@ -38,25 +40,95 @@ const (
 	pollFullState               time.Duration = 5000 * time.Millisecond
 )
 
+// tQueuedLine is a line waiting for transmission. jobLine marks the last
+// line sent for a line of the job program.
+type tQueuedLine struct {
+	cmd     string
+	jobLine bool
+}
+
+// tPendingAck is a line waiting for the answer of TinyG. jobLine marks
+// the last line sent for a line of the job program, status receives the
+// status of the answer if set.
+type tPendingAck struct {
+	jobLine bool
+	status  chan tgjson.TResponseStatusCode
+}
+
 // TinygController holds the internal hardware handels and publishes
 // methods for control and getting the state of the machine.
 type TinygController struct {
 	port               io.ReadWriteCloser
 	writeLock          sync.Mutex
 	initOnce           sync.Once
-	lineQueue          chan string
-	lineQueueEmptyFlag bool
+	lineQueue          chan tQueuedLine
+	lineQueueEmptyFlag int32
 	linesToSend        int32
+	jobActive          int32
 	lineQueueLock      sync.Mutex
 	exit               bool
 	tinygState         tgjson.TResponse
+	stateLock          sync.RWMutex
+	probeSeq           int
+	reports            map[string]int // offsets and positions reported by TinyG, by key
+	lastProbe          tgjson.TProbeReport
 	lastResponseTime   time.Time
-	// Optional reference to a Huanyan VFD
-	VfdOutput *vfdio.HyInverter
+	alarmLock          sync.Mutex
+	alarmLog           []TAlarmEvent
+	alarmSeq           int
+	alarmSubscribers   map[chan TAlarmEvent]bool
+	jogLock            sync.Mutex
+	jogWatchdog        *time.Timer
+	jogMove            string
+	homedLock          sync.Mutex
+	homedAxes          map[string]bool
+	heightMap          *THeightMap
+	selectedTool       int
+	spindleLock        sync.Mutex
+	spindleState       spindle.TCommandState
+	overrides          TOverrides
+	toolChangeLock     sync.Mutex
+	toolChange         TToolChangeState
+	toolChangeAnswer   chan bool
+	toolLengthZ        float64
+	toolLengthKnown    bool
+	jobLock            sync.Mutex
+	job                *TJob
+	jobSeq             int
+	jobFirstAlarm      int
+	jobLinesDone       int32 // program lines acknowledged by TinyG
+	ackLock            sync.Mutex
+	pendingAcks        []tPendingAck // lines waiting for an answer
+	txBusy             int32         // a line is processed by the transmitter
+	lastTx             int64         // time of the last transmitted G-code line in ns
+	consoleLock        sync.Mutex
+	console            []TConsoleLine // ring buffer of the serial traffic
+	consoleSeq         int
+	consoleSubscribers map[chan TConsoleLine]bool
+	// Axes which have to be homed before a program is accepted, e.g. "XYZ"
+	RequireHomed string
+	// Optional list of named positions
+	Positions *TSavedPositions
+	// Handling of M6 tool changes
+	ToolChange TToolChangeSettings
+	// Optional tool table, enables length compensation by the controller
+	Tools *TToolTable
+	// Travel range for manual moves
+	Envelope TEnvelope
+	// Optional spindle driver, e.g. a Huanyang VFD
+	Spindle spindle.Spindle
+	// Maximum time to wait for the spindle to reach the commanded speed
+	// before the program continues, 0 disables waiting
+	SpindleAtSpeedTimeout time.Duration
+	// Minimum RPM during a job in percent of the setpoint, 0 disables
+	// the stall detection
+	SpindleStallPercent float64
+	// Optional callback for finished jobs, e.g. for a job history
+	JobFinished func(job TJob)
 }
 
 func NewController() (controller *TinygController, err error) {
-	controller = &TinygController{}
+	controller = &TinygController{overrides: defaultOverrides()}
 	controller.tinygState = tgjson.TResponse{}
 	return
 }
@@ -67,7 +139,7 @@ func (o *TinygController) Open(portName string) (err error) {
 		glog.Error("Open can not be called from a nil pointer")
 	}
 	o.initOnce.Do(func() {
-		o.lineQueue = make(chan string, lineQueueLength)
+		o.lineQueue = make(chan tQueuedLine, lineQueueLength)
 		o.linesToSend = linesToSendDefault
 		atomic.StoreInt32(&o.linesToSend, linesToSendDefault)
 		portOptions := serial.OpenOptions{
@@ -79,13 +151,13 @@ func (o *TinygController) Open(portName string) (err error) {
 			RTSCTSFlowControl: true,
 			MinimumReadSize:   1,
 		}
-		o.port, err = serial.Open(portOptions)
-		if err == nil {
-			go o.serialRxLoop()
-			go o.serialTxLoop()
+		var port io.ReadWriteCloser
+		if port, err = serial.Open(portOptions); err == nil {
+			o.start(port)
 			go o.statePolling()
-			if o.VfdOutput != nil {
-				o.VfdOutput.GCode("S0 M5")
+			go o.spindleMonitor()
+			if o.Spindle != nil {
+				o.Spindle.Stop()
 			}
 		} else {
 			glog.Error(err)
@@ -94,6 +166,13 @@ func (o *TinygController) Open(portName string) (err error) {
 	return
 }
 
+// start runs the receiver and the transmitter on an opened port.
+func (o *TinygController) start(port io.ReadWriteCloser) {
+	o.port = port
+	go o.serialRxLoop()
+	go o.serialTxLoop()
+}
+
 func (o *TinygController) Close() {
 	o.port.Close()
 	o.exit = true
@@ -108,6 +187,7 @@ func (o *TinygController) serialRxLoop() {
 		// Handle data
 		jsonResponse := lineScanner.Text()
 		glog.Infoln("Tinyg Output: ", jsonResponse)
+		o.recordConsole(ConsoleRx, jsonResponse)
 		data, parseErr := tgjson.ParseResponse([]byte(jsonResponse))
 		if parseErr == nil {
 			o.lastResponseTime = time.Now()
@@ -116,65 +196,75 @@ func (o *TinygController) serialRxLoop() {
 				if linesToSendNow < linesToSendDefault {
 					atomic.AddInt32(&o.linesToSend, 1)
 				}
+				o.acknowledge(tgjson.TResponseStatusCode(data.ResponseFooter[1]))
 			}
+			if er := data.Exception(); er != nil && er.Status != tgjson.StatusOk {
+				o.recordAlarm(er.Status, er.Description())
+			}
+			o.stateLock.Lock()
 			o.tinygState.UpdateFrom(data) // overwrite buffered states with received values
+			o.countReports(&data.ResponseData)
+			if prb := data.Probe(); prb != nil {
+				o.probeSeq++
+				o.lastProbe = *prb
+			}
+			o.stateLock.Unlock()
+			o.updateJobActive()
 		} else {
 			glog.Warning("Input Error: ", jsonResponse, parseErr)
 		}
 	}
 }
 
-func (o *TinygController) handleVfdCommand(cmd string) {
-	// If a VFD is connected, output G-Code to the VFD processor
-	if o.VfdOutput != nil {
-		glog.Infoln("Vfd detected")
-		o.VfdOutput.GCodeWaiting(cmd)
-		vfdOk, _, _ := o.VfdOutput.Processed()
-		glog.Infoln("Vfd waiting for processing...")
-		for !vfdOk {
-			time.Sleep(5 * time.Millisecond)
-			vfdOk, _, _ = o.VfdOutput.Processed()
-		}
-		glog.Infoln("Vfd handled.")
-	}
-}
-
 func (o *TinygController) serialTxLoop() {
 	for !o.exit {
-		cmd := <-o.lineQueue
-		if o.lineQueueEmptyFlag {
+		entry := <-o.lineQueue
+		cmd := entry.cmd
+		atomic.StoreInt32(&o.txBusy, 1)
+		if atomic.LoadInt32(&o.lineQueueEmptyFlag) != 0 {
 			for len(o.lineQueue) > 0 {
-				cmd = <-o.lineQueue
+				<-o.lineQueue
 			}
-			o.lineQueueEmptyFlag = false
+			atomic.StoreInt32(&o.lineQueueEmptyFlag, 0)
 		} else {
 			if len(cmd) > 0 {
-				for o.linesToSend <= 0 {
+				for atomic.LoadInt32(&o.linesToSend) <= 0 {
 					time.Sleep(10 * time.Millisecond)
 				}
-				o.handleVfdCommand(cmd)
+				if cmd = o.interceptLine(cmd); len(cmd) == 0 {
+					o.jobLineDone(entry.jobLine) // handled by the controller, TinyG does not answer
+					atomic.StoreInt32(&o.txBusy, 0)
+					continue
+				}
+				o.handleSpindleCommand(cmd)
 				// Serial Output
-				cmd = string(append([]byte(cmd), []byte{0x0A}...)) // Append new line character
-				if !o.lineQueueEmptyFlag {                         // Again, check for flush flag
+				if atomic.LoadInt32(&o.lineQueueEmptyFlag) == 0 { // Again, check for flush flag
 					glog.Infoln("TX: '", cmd, "'")
-					o.writeLock.Lock()
-					o.port.Write([]byte(cmd))
-					o.writeLock.Unlock()
+					o.portWriteLine(cmd, tPendingAck{jobLine: entry.jobLine})
 					atomic.AddInt32(&o.linesToSend, -1)
+					if !gcode.IsJson(cmd) { // not a status poll
+						atomic.StoreInt64(&o.lastTx, time.Now().UnixNano())
+					}
 				}
+			} else {
+				o.jobLineDone(entry.jobLine) // empty or comment line
 			}
 		}
+		atomic.StoreInt32(&o.txBusy, 0)
 	}
 
 }
 
 func (o *TinygController) Flush() {
-	o.lineQueueEmptyFlag = true
-	o.writeLock.Lock()
-	o.port.Write([]byte{0x04})        // Send ^D flush command
-	o.port.Write([]byte("{clr:n}\n")) // Clear alarms
-	o.writeLock.Unlock()
+	atomic.StoreInt32(&o.lineQueueEmptyFlag, 1)
+	o.portWrite([]byte{0x04}) // Send ^D flush command
 	atomic.StoreInt32(&o.linesToSend, linesToSendDefault)
+	o.ackLock.Lock()
+	o.pendingAcks = nil
+	o.ackLock.Unlock()
+	atomic.StoreInt32(&o.jobActive, 0)
+	o.finishJob(JobCancelled)
+	o.CancelToolChange()
 }
 
 // RefreshState sends all required commands to Tinyg for reconstructing
@@ -224,30 +314,9 @@ func (o *TinygController) statePolling() {
 			o.write(tgjson.CommandRequestWorkingPosition, false)
 			break
 		case <-tickOffsets.C:
-			if o.tinygState.ResponseData.StatusReport != nil &&
-				o.tinygState.ResponseData.StatusReport.CoordinateSystem != nil {
-				switch *o.tinygState.ResponseData.StatusReport.CoordinateSystem {
-				case tgjson.CoordinateSystemG54:
-					o.write(tgjson.CommandRequestG54Offset, false)
-					break
-				case tgjson.CoordinateSystemG55:
-					o.write(tgjson.CommandRequestG55Offset, false)
-					break
-				case tgjson.CoordinateSystemG56:
-					o.write(tgjson.CommandRequestG56Offset, false)
-					break
-				case tgjson.CoordinateSystemG57:
-					o.write(tgjson.CommandRequestG57Offset, false)
-					break
-				case tgjson.CoordinateSystemG58:
-					o.write(tgjson.CommandRequestG58Offset, false)
-					break
-				case tgjson.CoordinateSystemG59:
-					o.write(tgjson.CommandRequestG59Offset, false)
-					break
-				default:
-					break
-				}
+			if sr := o.statusReport(); sr.CoordinateSystem != nil &&
+				*sr.CoordinateSystem != tgjson.CoordinateSystemG53 {
+				o.write(tgjson.CommandRequestWorkOffset(*sr.CoordinateSystem), false)
 			}
 			o.write(tgjson.CommandRequestG92Offset, false)
 			break
@@ -266,7 +335,23 @@ func eraseGcodeComments(in string) string {
 	return out2[0]
 }
 
+// cleanLine removes comments and line endings of a line.
+func cleanLine(cmd string) string {
+	cmd = eraseGcodeComments(cmd)
+	cmd = strings.TrimSuffix(cmd, "\n")
+	cmd = strings.TrimSuffix(cmd, "\r")
+	return strings.TrimSpace(cmd)
+}
+
 func (o *TinygController) writeLines(cmds []string, queue bool) (inserted bool) {
+	entries := make([]tQueuedLine, len(cmds))
+	for n, cmd := range cmds {
+		entries[n] = tQueuedLine{cmd: cleanLine(cmd)}
+	}
+	return o.enqueue(entries, queue)
+}
+
+func (o *TinygController) enqueue(entries []tQueuedLine, queue bool) (inserted bool) {
 	o.lineQueueLock.Lock()
 	if queue {
 		inserted = true
@@ -277,12 +362,8 @@ func (o *TinygController) writeLines(cmds []string, queue bool) (inserted bool)
 		}
 	}
 	if inserted {
-		for _, cmd := range cmds {
-			cmd = eraseGcodeComments(cmd)
-			cmd = strings.TrimSuffix(cmd, "\n")
-			cmd = strings.TrimSuffix(cmd, "\r")
-			cmd = strings.TrimSpace(cmd)
-			o.lineQueue <- cmd
+		for _, entry := range entries {
+			o.lineQueue <- entry
 		}
 	}
 	o.lineQueueLock.Unlock()
@@ -299,31 +380,83 @@ func (o *TinygController) Write(cmd string) bool {
 	return o.write(cmd, true)
 }
 
+// WriteLines queues the lines of a job. Z is compensated by the active
+// height map, lines which can not be compensated reject the whole job.
 func (o *TinygController) WriteLines(cmds []string) bool {
-	return o.writeLines(cmds, true)
+	lines, err := o.levelJob(cmds)
+	if err != nil {
+		glog.Error(err)
+		return false
+	}
+	return o.queueJob(lines)
+}
+
+func (o *TinygController) queueJob(lines [][]string) bool {
+	o.markJobActive()
+	return o.enqueue(jobEntries(lines), true)
+}
+
+// jobEntries returns the queue entries of the lines sent for each program
+// line. The last of them counts the program line as done when TinyG
+// answers it.
+func jobEntries(lines [][]string) []tQueuedLine {
+	entries := make([]tQueuedLine, 0, len(lines))
+	for _, sent := range lines {
+		for n, cmd := range sent {
+			entries = append(entries, tQueuedLine{cmd: cmd, jobLine: n == len(sent)-1})
+		}
+	}
+	return entries
+}
+
+// markJobActive sets the job flag before the lines are queued. The job is
+// not finished by updateJobActive until the settle time has passed.
+func (o *TinygController) markJobActive() {
+	atomic.StoreInt64(&o.lastTx, time.Now().UnixNano())
+	atomic.StoreInt32(&o.jobActive, 1)
+}
+
+// JobRunning returns true while lines written by WriteLines are
+// queued or still executed by TinyG.
+func (o *TinygController) JobRunning() bool {
+	return len(o.lineQueue) > 0 || atomic.LoadInt32(&o.jobActive) != 0
+}
+
+// updateJobActive resets the job flag as soon as the queue is drained
+// and TinyG has stopped.
+func (o *TinygController) updateJobActive() {
+	if atomic.LoadInt32(&o.jobActive) == 0 || len(o.lineQueue) > 0 || atomic.LoadInt32(&o.txBusy) != 0 {
+		return
+	}
+	if time.Since(time.Unix(0, atomic.LoadInt64(&o.lastTx))) < jobSettleTime {
+		return // the status report may not show the last moves yet
+	}
+	if state, ok := o.machineState(); ok {
+		switch state {
+		case tgjson.StateRun, tgjson.StateHold, tgjson.StateCycle, tgjson.StateProbe, tgjson.StateHoming:
+		default:
+			atomic.StoreInt32(&o.jobActive, 0)
+			o.finishJob(JobCompleted)
+		}
+	}
 }
 
 // TinygReset performs a software reset of the hardware.
 func (o *TinygController) TinygReset() error {
-	o.writeLock.Lock()
-	o.port.Write([]byte{24}) // CTRL-X
-	o.writeLock.Unlock()
+	o.portWrite([]byte{24}) // CTRL-X
+	o.resetHomed()
 	time.Sleep(5 * time.Second)
 	o.Flush()
 	return nil
 }
 
 func (o *TinygController) FeedHold() error {
-	o.writeLock.Lock()
-	o.port.Write([]byte{'!'})
-	o.writeLock.Unlock()
+	o.portWrite([]byte{'!'})
 	return nil
 }
 
 func (o *TinygController) FeedResume() error {
-	o.writeLock.Lock()
-	o.port.Write([]byte{'~'})
-	o.writeLock.Unlock()
+	o.portWrite([]byte{'~'})
 	return nil
 
 }
@@ -333,5 +466,87 @@ func (o *TinygController) Online() bool {
 }
 
 func (o *TinygController) StateJson() []byte {
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
 	return o.tinygState.Json()
 }
+
+// NamedStateJson is StateJson with additional symbolic names
+// for all enumerated values and the current overrides ("ovr").
+func (o *TinygController) NamedStateJson() []byte {
+	o.stateLock.RLock()
+	state := o.tinygState.NamedJson()
+	o.stateLock.RUnlock()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(state, &fields); err != nil {
+		panic(err)
+	}
+	overrides, err := json.Marshal(o.Overrides())
+	if err != nil {
+		panic(err)
+	}
+	fields["ovr"] = overrides
+	state, err = json.Marshal(fields)
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
+
+// statusReport returns a copy of the last known status report.
+func (o *TinygController) statusReport() (sr tgjson.TStatusReport) {
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
+	if o.tinygState.ResponseData.StatusReport != nil {
+		sr = *o.tinygState.ResponseData.StatusReport
+	}
+	return
+}
+
+// machineState returns the last reported machine state. ok is false
+// if TinyG has not reported its state yet.
+func (o *TinygController) machineState() (state tgjson.TMachineState, ok bool) {
+	sr := o.statusReport()
+	if sr.MachineState == nil {
+		return
+	}
+	return *sr.MachineState, true
+}
+
+// waitForState polls the status until cond is true for the machine state
+// or the timeout is reached. Returns false on timeout.
+func (o *TinygController) waitForState(cond func(state tgjson.TMachineState) bool, timeout time.Duration) bool {
+	return o.waitFor(func() bool {
+		state, ok := o.machineState()
+		return ok && cond(state)
+	}, tgjson.CommandRequestStatus, timeout)
+}
+
+// waitFor sends the request command until cond is true or the timeout
+// is reached. Returns false on timeout.
+func (o *TinygController) waitFor(cond func() bool, request string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		o.writeDirect(request)
+		time.Sleep(250 * time.Millisecond)
+	}
+	return false
+}
+
+// writeDirect sends a single line to TinyG, bypassing the line queue.
+func (o *TinygController) writeDirect(cmd string) {
+	glog.Infoln("TX direct: '", cmd, "'")
+	o.portWriteLine(cmd, tPendingAck{})
+}
+
+// writeDirectAnswered is writeDirect returning a channel which receives
+// the status of TinyG's answer to the line.
+func (o *TinygController) writeDirectAnswered(cmd string) <-chan tgjson.TResponseStatusCode {
+	glog.Infoln("TX direct: '", cmd, "'")
+	status := make(chan tgjson.TResponseStatusCode, 1)
+	o.portWriteLine(cmd, tPendingAck{status: status})
+	return status
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"strings"
+)
+
+var ErrOutsideEnvelope = errors.New("target outside of the machine envelope")
+
+// TEnvelope is the travel range of the machine in machine coordinates.
+// Manual moves (jogs and saved positions) are limited to the envelope.
+// Axes with Max <= Min are not limited.
+type TEnvelope struct {
+	Min tgjson.TOffset `json:"min"`
+	Max tgjson.TOffset `json:"max"`
+}
+
+// Limited returns true if the envelope is set for the axis ("X", "Y" or "Z").
+func (o TEnvelope) Limited(axis string) bool {
+	return offsetAxis(o.Max, axis) > offsetAxis(o.Min, axis)
+}
+
+// ContainsAxis returns true if value is within the range of an axis.
+func (o TEnvelope) ContainsAxis(axis string, value float64) bool {
+	return !o.Limited(axis) ||
+		(value >= offsetAxis(o.Min, axis) && value <= offsetAxis(o.Max, axis))
+}
+
+// Contains returns true if a machine position is within the envelope.
+func (o TEnvelope) Contains(pos tgjson.TOffset) bool {
+	return o.ContainsAxis("X", pos.X) && o.ContainsAxis("Y", pos.Y) && o.ContainsAxis("Z", pos.Z)
+}
+
+// Clamp limits a relative move of an axis starting at from to the envelope.
+func (o TEnvelope) Clamp(axis string, from, distance float64) float64 {
+	if !o.Limited(axis) {
+		return distance
+	}
+	target := from + distance
+	if min := offsetAxis(o.Min, axis); target < min {
+		target = min
+	}
+	if max := offsetAxis(o.Max, axis); target > max {
+		target = max
+	}
+	return target - from
+}
+
+// machinePosition returns the current machine position. The polled
+// machine position is updated rarely, so it is calculated from the work
+// position of the status report and the offsets if TinyG has reported
+// them. Unreported values are unknown, not zero.
+func (o *TinygController) machinePosition() (pos tgjson.TOffset, ok bool) {
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
+	data := &o.tinygState.ResponseData
+	if sr := data.StatusReport; sr != nil && sr.CoordinateSystem != nil &&
+		sr.WorkingPositionX != nil && sr.WorkingPositionY != nil && sr.WorkingPositionZ != nil {
+		pos = tgjson.TOffset{X: *sr.WorkingPositionX, Y: *sr.WorkingPositionY, Z: *sr.WorkingPositionZ}
+		offset, known := &tgjson.TOffset{}, true
+		if cs := *sr.CoordinateSystem; cs != tgjson.CoordinateSystemG53 {
+			offset = data.WorkOffset(cs)
+			known = offset != nil && o.reports[strings.ToLower(cs.String())] > 0
+		}
+		if known && o.reports["g92"] > 0 {
+			pos.X += offset.X + data.AddonOffsetG92.X
+			pos.Y += offset.Y + data.AddonOffsetG92.Y
+			pos.Z += offset.Z + data.AddonOffsetG92.Z
+			return pos, true
+		}
+	}
+	if o.reports["mpo"] > 0 {
+		return *data.AbsoluteMachinePosition, true
+	}
+	return tgjson.TOffset{}, false
+}
+
+// limitJog checks a relative jog against the envelope. With clamp set
+// the distance is shortened to stop at the envelope, otherwise moves
+// leaving the envelope are refused.
+func (o *TinygController) limitJog(axis string, distance float64, clamp bool) (float64, error) {
+	if !o.Envelope.Limited(axis) {
+		return distance, nil
+	}
+	pos, ok := o.machinePosition()
+	if !ok {
+		return 0, ErrMachinePositionUnset
+	}
+	from := offsetAxis(pos, axis)
+	if clamp {
+		return o.Envelope.Clamp(axis, from, distance), nil
+	}
+	if !o.Envelope.ContainsAxis(axis, from+distance) {
+		return 0, ErrOutsideEnvelope
+	}
+	return distance, nil
+}
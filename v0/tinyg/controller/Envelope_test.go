@@ -0,0 +1,26 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"testing"
+)
+
+func TestMachinePosition(t *testing.T) {
+	tg, _ := newTestController(t, nil)
+	setState(t, tg, `{"sr":{"coor":2,"posx":1,"posy":2,"posz":3}}`)
+	if pos, ok := tg.machinePosition(); ok {
+		t.Error("Position known without offsets: ", pos)
+	}
+	setState(t, tg, `{"r":{"g55":{"x":10,"y":20,"z":-30}},"f":[1,0,8]}`)
+	if pos, ok := tg.machinePosition(); ok {
+		t.Error("Position known without G92: ", pos)
+	}
+	setState(t, tg, `{"r":{"mpo":{"x":7,"y":8,"z":9}},"f":[1,0,8]}`)
+	if pos, _ := tg.machinePosition(); pos != (tgjson.TOffset{X: 7, Y: 8, Z: 9}) {
+		t.Error("Reported machine position not used: ", pos)
+	}
+	setState(t, tg, `{"r":{"g92":{"x":0,"y":0,"z":1}},"f":[1,0,8]}`)
+	if pos, _ := tg.machinePosition(); pos != (tgjson.TOffset{X: 11, Y: 22, Z: -26}) {
+		t.Error("Wrong calculated position: ", pos)
+	}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ackResponse is the answer of TinyG to a line without errors.
+const ackResponse string = `{"r":{},"f":[1,0,8]}`
+
+// tFakePort replaces the serial port of TinyG. Written lines are recorded
+// and passed to respond, its answers are read by the controller in order.
+type tFakePort struct {
+	lock    sync.Mutex
+	written []string
+	respond func(line string) []string
+	answers chan string
+	reader  *io.PipeReader
+	writer  *io.PipeWriter
+}
+
+func newFakePort(respond func(line string) []string) *tFakePort {
+	o := &tFakePort{respond: respond, answers: make(chan string, 100)}
+	o.reader, o.writer = io.Pipe()
+	go func() {
+		for answer := range o.answers {
+			o.writer.Write([]byte(answer + "\n"))
+		}
+	}()
+	return o
+}
+
+// ackLines answers every line like TinyG, realtime commands are not answered.
+func ackLines(line string) []string {
+	if len(line) == 1 {
+		return nil
+	}
+	return []string{ackResponse}
+}
+
+func (o *tFakePort) Read(p []byte) (int, error) {
+	return o.reader.Read(p)
+}
+
+func (o *tFakePort) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		o.lock.Lock()
+		o.written = append(o.written, line)
+		o.lock.Unlock()
+		if o.respond != nil {
+			for _, answer := range o.respond(line) {
+				o.answers <- answer
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (o *tFakePort) Close() error {
+	return o.writer.Close()
+}
+
+// Send passes a line from TinyG to the controller.
+func (o *tFakePort) Send(line string) {
+	o.answers <- line
+}
+
+// Written returns the lines written by the controller.
+func (o *tFakePort) Written() []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append([]string(nil), o.written...)
+}
+
+// newTestController returns a controller connected to a fake port. State
+// polling and the spindle monitor are not started.
+func newTestController(t *testing.T, respond func(line string) []string) (*TinygController, *tFakePort) {
+	tg, _ := NewController()
+	tg.lineQueue = make(chan tQueuedLine, lineQueueLength)
+	atomic.StoreInt32(&tg.linesToSend, linesToSendDefault)
+	port := newFakePort(respond)
+	tg.start(port)
+	t.Cleanup(func() { port.Close() })
+	return tg, port
+}
+
+// waitFor polls a condition for up to two seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatal("Timeout waiting for ", what)
+}
+
+// setState updates the known state of TinyG as if the response was received.
+func setState(t *testing.T, tg *TinygController, response string) {
+	t.Helper()
+	data, err := tgjson.ParseResponse([]byte(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.stateLock.Lock()
+	tg.tinygState.UpdateFrom(data)
+	tg.countReports(&data.ResponseData)
+	tg.stateLock.Unlock()
+}
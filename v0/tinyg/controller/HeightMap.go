@@ -0,0 +1,322 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io/ioutil"
+	"math"
+)
+
+const heightMapSegmentLength float64 = 5.0 // mm, longer moves are split
+
+var ErrInvalidGrid = errors.New("invalid probing grid")
+var ErrLevelingArc = errors.New("arc can not be leveled")
+
+// THeightMap stores the surface heights of a rectangular grid in work
+// coordinates. Values are relative to the first probed point
+// (Values[0][0] == 0), indexed by row (Y) and column (X).
+type THeightMap struct {
+	OriginX float64     `json:"originX"`
+	OriginY float64     `json:"originY"`
+	StepX   float64     `json:"stepX"`
+	StepY   float64     `json:"stepY"`
+	Values  [][]float64 `json:"values"`
+}
+
+// LoadHeightMap reads a height map saved by Save.
+func LoadHeightMap(path string) (heightMap *THeightMap, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	heightMap = &THeightMap{}
+	if err = json.Unmarshal(data, heightMap); err != nil {
+		return nil, err
+	}
+	if !heightMap.valid() {
+		return nil, ErrInvalidGrid
+	}
+	return
+}
+
+// valid returns true for a grid of at least 2 x 2 points with positive
+// steps and the same number of values in every row, as created by
+// ProbeHeightMap.
+func (o *THeightMap) valid() bool {
+	if len(o.Values) < 2 || len(o.Values[0]) < 2 || o.StepX <= 0 || o.StepY <= 0 {
+		return false
+	}
+	for _, row := range o.Values {
+		if len(row) != len(o.Values[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Save writes the height map as JSON file.
+func (o *THeightMap) Save(path string) error {
+	data, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Height returns the bilinear interpolated height at x, y. Points
+// outside the grid use the height of the nearest border.
+func (o *THeightMap) Height(x, y float64) float64 {
+	rows, cols := len(o.Values), len(o.Values[0])
+	fx, ix := gridPosition(x, o.OriginX, o.StepX, cols)
+	fy, iy := gridPosition(y, o.OriginY, o.StepY, rows)
+	ix1, iy1 := ix, iy
+	if ix+1 < cols {
+		ix1 = ix + 1
+	}
+	if iy+1 < rows {
+		iy1 = iy + 1
+	}
+	bottom := o.Values[iy][ix]*(1-fx) + o.Values[iy][ix1]*fx
+	top := o.Values[iy1][ix]*(1-fx) + o.Values[iy1][ix1]*fx
+	return bottom*(1-fy) + top*fy
+}
+
+// gridPosition returns the cell index and the fraction within the cell
+// of a coordinate, clamped to the grid.
+func gridPosition(value, origin, step float64, count int) (fraction float64, index int) {
+	if count < 2 || step == 0 {
+		return 0, 0
+	}
+	cell := (value - origin) / step
+	if cell <= 0 {
+		return 0, 0
+	}
+	if cell >= float64(count-1) {
+		return 0, count - 1
+	}
+	index = int(math.Floor(cell))
+	return cell - float64(index), index
+}
+
+// tLeveler rewrites G-code moves by adding the height of the surface
+// to Z. Straight moves are split and arcs in the XY plane are replaced by
+// straight segments, so Z follows the surface. The height map is in mm,
+// inch programs are converted.
+type tLeveler struct {
+	heightMap *THeightMap
+	state     *gcode.TState
+	sent      int // motion mode of TinyG, which differs from the program after arcs
+}
+
+func newLeveler(heightMap *THeightMap) *tLeveler {
+	return &tLeveler{heightMap: heightMap, state: gcode.NewState(), sent: gcode.MotionUnknown}
+}
+
+// motionWord returns the G0 to G3 word of a line.
+func motionWord(line gcode.TLine) (motion int, ok bool) {
+	for _, word := range line.Words {
+		if word.Is('G', 0) || word.Is('G', 1) || word.Is('G', 2) || word.Is('G', 3) {
+			return int(word.Value), true
+		}
+	}
+	return gcode.MotionUnknown, false
+}
+
+// Transform returns the compensated lines for a single input line.
+// Lines without moves, moves in incremental mode and moves with
+// unknown start position are passed through or only get their end
+// point compensated. Arcs outside the XY plane or with unknown start
+// can not be compensated.
+func (o *tLeveler) Transform(cmd string) ([]string, error) {
+	if len(cmd) == 0 || gcode.IsJson(cmd) {
+		return []string{cmd}, nil
+	}
+	line := gcode.ParseLine(cmd)
+	start, startKnown := o.state.Position, o.state.Known
+	startComplete := startKnown[gcode.AxisX] && startKnown[gcode.AxisY] && startKnown[gcode.AxisZ]
+	move := o.state.Apply(line)
+	arc := o.state.Motion == gcode.MotionArcCw || o.state.Motion == gcode.MotionArcCcw
+	if move && arc && !o.state.Incremental {
+		if o.state.Plane != gcode.PlaneXY {
+			return nil, fmt.Errorf("%w: arc outside the XY plane: %s", ErrLevelingArc, cmd)
+		}
+		if !startComplete {
+			return nil, fmt.Errorf("%w: arc from unknown position: %s", ErrLevelingArc, cmd)
+		}
+	}
+	end := o.state.Position
+	endComplete := o.state.Known[gcode.AxisX] && o.state.Known[gcode.AxisY] && o.state.Known[gcode.AxisZ]
+	if !move || o.state.Incremental || !endComplete {
+		// Z can not be compensated without a complete position
+		return []string{o.passThrough(cmd, line, move)}, nil
+	}
+	scale := 1.0
+	if o.state.Inch {
+		scale = gcode.MillimetersPerInch
+	}
+	var points [][3]float64
+	words := line.Without("XYZ")
+	motion := o.state.Motion
+	switch {
+	case arc:
+		var ok bool
+		points, ok = gcode.SplitArc(motion == gcode.MotionArcCw, start, end, line, heightMapSegmentLength/scale)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid arc: %s", ErrLevelingArc, cmd)
+		}
+		words = words.Without("IJKR").WithoutCode('G', 2).WithoutCode('G', 3)
+		motion = gcode.MotionStraight
+	case startComplete:
+		length := math.Hypot(end[gcode.AxisX]-start[gcode.AxisX], end[gcode.AxisY]-start[gcode.AxisY])
+		segments := int(math.Ceil(length * scale / heightMapSegmentLength))
+		for n := 1; n < segments; n++ {
+			f := float64(n) / float64(segments)
+			points = append(points, [3]float64{
+				start[gcode.AxisX] + (end[gcode.AxisX]-start[gcode.AxisX])*f,
+				start[gcode.AxisY] + (end[gcode.AxisY]-start[gcode.AxisY])*f,
+				start[gcode.AxisZ] + (end[gcode.AxisZ]-start[gcode.AxisZ])*f,
+			})
+		}
+		points = append(points, end)
+	default:
+		points = [][3]float64{end}
+	}
+	if explicit, ok := motionWord(words); !ok && o.sent != motion {
+		words.Words = append([]gcode.TWord{{Letter: 'G', Value: float64(motion)}}, words.Words...)
+	} else if ok {
+		motion = explicit
+	}
+	o.sent = motion
+	out := make([]string, 0, len(points))
+	prefix := words.String() // modal and other words are sent with the first segment
+	for _, p := range points {
+		z := p[gcode.AxisZ] + o.heightMap.Height(p[gcode.AxisX]*scale, p[gcode.AxisY]*scale)/scale
+		coords := fmt.Sprintf("X%s Y%s Z%s", gcode.FormatNumber(p[gcode.AxisX]), gcode.FormatNumber(p[gcode.AxisY]), gcode.FormatNumber(z))
+		if len(prefix) > 0 {
+			out = append(out, prefix+" "+coords)
+			prefix = ""
+		} else {
+			out = append(out, coords)
+		}
+	}
+	return out, nil
+}
+
+// passThrough returns a line unchanged, except for moves which rely on the
+// program motion mode after TinyG has been switched to G1 for arcs.
+func (o *tLeveler) passThrough(cmd string, line gcode.TLine, move bool) string {
+	if motion, ok := motionWord(line); ok {
+		o.sent = motion
+		return cmd
+	}
+	if move && o.sent != gcode.MotionUnknown && o.sent != o.state.Motion {
+		o.sent = o.state.Motion
+		return fmt.Sprintf("G%d %s", o.state.Motion, cmd)
+	}
+	return cmd
+}
+
+// SetHeightMap enables Z compensation for all jobs started afterwards.
+// Manual commands are never compensated. A nil height map disables the
+// compensation.
+func (o *TinygController) SetHeightMap(heightMap *THeightMap) {
+	o.lineQueueLock.Lock()
+	defer o.lineQueueLock.Unlock()
+	o.heightMap = heightMap
+}
+
+// levelJob returns the lines to send for each line of a job, compensated
+// by the active height map. Every job starts with a new leveler, the
+// position left by previous commands is unknown to it.
+func (o *TinygController) levelJob(cmds []string) ([][]string, error) {
+	out := make([][]string, len(cmds))
+	heightMap := o.HeightMap()
+	if heightMap == nil {
+		for n, cmd := range cmds {
+			out[n] = []string{cleanLine(cmd)}
+		}
+		return out, nil
+	}
+	leveler := newLeveler(heightMap)
+	for n, cmd := range cmds {
+		leveled, err := leveler.Transform(cleanLine(cmd))
+		if err != nil {
+			return nil, err
+		}
+		out[n] = leveled
+	}
+	return out, nil
+}
+
+// HeightMap returns the active height map or nil.
+func (o *TinygController) HeightMap() *THeightMap {
+	o.lineQueueLock.Lock()
+	defer o.lineQueueLock.Unlock()
+	return o.heightMap
+}
+
+// ProbeHeightMap probes a grid of cols x rows points between (x0, y0) and
+// (x1, y1) in work coordinates. Between the points the probe is raised
+// to the work coordinate clearance. The result is not activated.
+func (o *TinygController) ProbeHeightMap(x0, y0, x1, y1 float64, cols, rows int, clearance float64, settings TProbeSettings) (heightMap *THeightMap, err error) {
+	if cols < 2 || rows < 2 || x1 <= x0 || y1 <= y0 {
+		return nil, ErrInvalidGrid
+	}
+	if settings.Feed <= 0 {
+		return nil, ErrInvalidFeed
+	}
+	if o.JobRunning() {
+		return nil, ErrJobRunning
+	}
+	heightMap = &THeightMap{
+		OriginX: x0,
+		OriginY: y0,
+		StepX:   (x1 - x0) / float64(cols-1),
+		StepY:   (y1 - y0) / float64(rows-1),
+		Values:  make([][]float64, rows),
+	}
+	reference := 0.0
+	for row := 0; row < rows; row++ {
+		heightMap.Values[row] = make([]float64, cols)
+		for n := 0; n < cols; n++ {
+			col := n
+			if row%2 == 1 {
+				col = cols - 1 - n // serpentine path
+			}
+			o.writeDirect("G90 G0 Z" + gcode.FormatNumber(clearance))
+			o.writeDirect(fmt.Sprintf("G0 X%s Y%s",
+				gcode.FormatNumber(x0+float64(col)*heightMap.StepX),
+				gcode.FormatNumber(y0+float64(row)*heightMap.StepY)))
+			var pos tgjson.TOffset
+			if pos, err = o.probe("Z", -1, settings.MaxDistance, settings.Feed); err != nil {
+				o.writeDirect("G90 G0 Z" + gcode.FormatNumber(clearance))
+				return nil, err
+			}
+			if row == 0 && col == 0 {
+				reference = pos.Z
+			}
+			heightMap.Values[row][col] = pos.Z - reference
+		}
+	}
+	o.writeDirect("G90 G0 Z" + gcode.FormatNumber(clearance))
+	return
+}
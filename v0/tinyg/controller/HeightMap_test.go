@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"errors"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testHeightMap() *THeightMap {
+	return &THeightMap{
+		OriginX: 0,
+		OriginY: 0,
+		StepX:   10,
+		StepY:   10,
+		Values: [][]float64{
+			{0, 1},
+			{2, 3},
+		},
+	}
+}
+
+func TestHeightMapInterpolation(t *testing.T) {
+	heightMap := testHeightMap()
+	cases := []struct{ x, y, z float64 }{
+		{0, 0, 0},
+		{10, 0, 1},
+		{0, 10, 2},
+		{5, 5, 1.5},
+		{-5, -5, 0}, // clamped to the grid
+		{20, 20, 3},
+	}
+	for _, c := range cases {
+		if z := heightMap.Height(c.x, c.y); math.Abs(z-c.z) > 1e-9 {
+			t.Errorf("Height(%v, %v) = %v, expected %v", c.x, c.y, z, c.z)
+		}
+	}
+}
+
+func TestLevelerSplitsMoves(t *testing.T) {
+	leveler := newLeveler(testHeightMap())
+	if out, _ := leveler.Transform("G0 X0 Y0 Z1"); len(out) != 1 || out[0] != "G0 X0.0000 Y0.0000 Z1.0000" {
+		t.Error("Unexpected first move: ", out)
+	}
+	out, _ := leveler.Transform("G1 X10 F100")
+	if len(out) != 2 {
+		t.Fatal("Move has not been split: ", out)
+	}
+	if out[0] != "G1 F100 X5.0000 Y0.0000 Z1.5000" || out[1] != "X10.0000 Y0.0000 Z2.0000" {
+		t.Error("Unexpected segments: ", out)
+	}
+	if out, _ := leveler.Transform("M3 S1000"); len(out) != 1 || out[0] != "M3 S1000" {
+		t.Error("Non-move lines have to pass unchanged: ", out)
+	}
+}
+
+func TestLevelerInch(t *testing.T) {
+	leveler := newLeveler(testHeightMap())
+	leveler.Transform("G20 G0 X0 Y0 Z0")
+	// 0.2 inch = 5.08 mm, the height map is in mm
+	out, err := leveler.Transform("G1 X0.2 F10")
+	if err != nil || len(out) != 2 {
+		t.Fatal("Move has not been split by mm: ", out, err)
+	}
+	if z := 0.508 / 25.4; out[1] != "X0.2000 Y0.0000 Z"+gcode.FormatNumber(z) {
+		t.Error("Height not converted to inch: ", out)
+	}
+}
+
+func TestLevelerArcs(t *testing.T) {
+	cases := []struct {
+		arc      string
+		segments int
+		end      string
+	}{
+		{"G2 X10 Y0 I5 J0", 4, "X10.0000 Y0.0000 Z1.0000"},     // half circle above the X axis, r=5
+		{"G3 X10 Y0 R5", 4, "X10.0000 Y0.0000 Z1.0000"},        // below the X axis
+		{"G2 X0 Y0 I0 J5", 7, "X0.0000 Y0.0000 Z0.0000"},       // full circle
+		{"G2 X10 Y0 Z-1 I5 J0", 4, "X10.0000 Y0.0000 Z0.0000"}, // helix
+	}
+	for _, c := range cases {
+		leveler := newLeveler(testHeightMap())
+		leveler.Transform("G0 X0 Y0 Z0")
+		out, err := leveler.Transform(c.arc)
+		if err != nil || len(out) != c.segments || out[len(out)-1] != c.end || !strings.HasPrefix(out[0], "G1 X") {
+			t.Error(c.arc, ": ", out, err)
+		}
+		// Modal moves after the arc continue as arc
+		if out, _ := leveler.Transform("G91"); out[0] != "G91" {
+			t.Error("Unexpected: ", out)
+		}
+		if out, _ := leveler.Transform("X1 Y1 I1"); out[0] != "G"+c.arc[1:2]+" X1 Y1 I1" {
+			t.Error("Motion mode not restored: ", out)
+		}
+	}
+	leveler := newLeveler(testHeightMap())
+	leveler.Transform("G0 X0 Y0 Z0")
+	if _, err := leveler.Transform("G18 G2 X10 Z0 I5 K0"); !errors.Is(err, ErrLevelingArc) {
+		t.Error("Arc in XZ plane accepted: ", err)
+	}
+	if _, err := newLeveler(testHeightMap()).Transform("G2 X10 Y0 Z0 I5 J0"); !errors.Is(err, ErrLevelingArc) {
+		t.Error("Arc from unknown position accepted: ", err)
+	}
+}
+
+func TestLevelJobStartsUnknown(t *testing.T) {
+	controller, _ := NewController()
+	controller.SetHeightMap(testHeightMap())
+	if lines, err := controller.levelJob([]string{"G0 X0 Y0 Z0", "G1 X10 F100 (cut)"}); err != nil || len(lines) != 2 || len(lines[1]) != 2 {
+		t.Fatal("First job not leveled: ", lines, err)
+	}
+	// The position of the previous job is not used
+	if lines, err := controller.levelJob([]string{"G1 X10"}); err != nil || len(lines) != 1 || lines[0][0] != "G1 X10" {
+		t.Error("Second job leveled from unknown position: ", lines, err)
+	}
+	controller.SetHeightMap(nil)
+	if lines, _ := controller.levelJob([]string{"G0 X0 Y0 Z0"}); lines[0][0] != "G0 X0 Y0 Z0" {
+		t.Error("Disabled height map applied: ", lines)
+	}
+}
+
+func TestLoadHeightMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "map.json")
+	if err = testHeightMap().Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadHeightMap(path); err != nil {
+		t.Error(err)
+	}
+	invalid := []string{
+		`{"stepX":10,"stepY":10,"values":[[0,1],[2]]}`,
+		`{"stepX":0,"stepY":10,"values":[[0,1],[2,3]]}`,
+		`{"stepX":10,"stepY":-1,"values":[[0,1],[2,3]]}`,
+		`{"stepX":10,"stepY":10,"values":[[0,1]]}`,
+	}
+	for _, data := range invalid {
+		ioutil.WriteFile(path, []byte(data), 0644)
+		if _, err = LoadHeightMap(path); err != ErrInvalidGrid {
+			t.Errorf("Height map %s accepted: %v", data, err)
+		}
+	}
+}
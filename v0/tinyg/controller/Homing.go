@@ -0,0 +1,151 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	homingStartTimeout time.Duration = 5 * time.Second
+	homingTimeout      time.Duration = 3 * time.Minute
+)
+
+var (
+	ErrHomingTimeout = errors.New("homing cycle timed out")
+	ErrNotHomed      = errors.New("required axes are not homed")
+)
+
+// HomingError is returned by Home if TinyG reported a failure
+// during the homing cycle.
+type HomingError struct {
+	Status  tgjson.TResponseStatusCode
+	Message string
+}
+
+func (e *HomingError) Error() string {
+	return fmt.Sprintf("homing failed: %s (%d)", e.Message, int(e.Status))
+}
+
+// Home runs the homing cycle (G28.2) for the given axes, e.g. Home("x", "y").
+// Without axes X, Y and Z are homed. Home blocks until the cycle has
+// finished and records the homed axes on success.
+func (o *TinygController) Home(axes ...string) (err error) {
+	if len(axes) == 0 {
+		axes = []string{"X", "Y", "Z"}
+	}
+	words := make([]string, len(axes))
+	for n := range axes {
+		if axes[n], err = normalizeAxis(axes[n]); err != nil {
+			return
+		}
+		words[n] = axes[n] + "0"
+	}
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	alarmsBefore := o.lastAlarmId()
+	o.setHomed(false, axes...)
+	o.writeDirect("G28.2 " + strings.Join(words, " "))
+	// Wait for TinyG to enter and leave the homing state
+	if !o.waitForState(func(state tgjson.TMachineState) bool { return state == tgjson.StateHoming }, homingStartTimeout) {
+		if err = o.homingFailure(alarmsBefore); err == nil {
+			err = ErrHomingTimeout
+		}
+		return
+	}
+	if !o.waitForState(func(state tgjson.TMachineState) bool { return state != tgjson.StateHoming }, homingTimeout) {
+		o.FeedHold()
+		return ErrHomingTimeout
+	}
+	if err = o.homingFailure(alarmsBefore); err != nil {
+		return
+	}
+	if state, _ := o.machineState(); state == tgjson.StateAlarm {
+		return &HomingError{Status: tgjson.StatusHomingCycleFailed, Message: tgjson.StatusHomingCycleFailed.Message()}
+	}
+	o.setHomed(true, axes...)
+	return
+}
+
+// homingFailure returns the first alarm recorded after the alarm with id since.
+func (o *TinygController) homingFailure(since int) error {
+	for _, event := range o.Alarms(since) {
+		return &HomingError{Status: event.Status, Message: event.Message}
+	}
+	return nil
+}
+
+func (o *TinygController) setHomed(homed bool, axes ...string) {
+	o.homedLock.Lock()
+	defer o.homedLock.Unlock()
+	if o.homedAxes == nil {
+		o.homedAxes = make(map[string]bool)
+	}
+	for _, axis := range axes {
+		if homed {
+			o.homedAxes[axis] = true
+		} else {
+			delete(o.homedAxes, axis)
+		}
+	}
+}
+
+// resetHomed forgets all homed axes, e.g. after a reset or a limit switch hit.
+func (o *TinygController) resetHomed() {
+	o.homedLock.Lock()
+	defer o.homedLock.Unlock()
+	o.homedAxes = nil
+}
+
+// HomedAxes returns the sorted list of axes homed since the last reset.
+func (o *TinygController) HomedAxes() (axes []string) {
+	o.homedLock.Lock()
+	defer o.homedLock.Unlock()
+	axes = make([]string, 0, len(o.homedAxes))
+	for axis := range o.homedAxes {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+	return
+}
+
+// MissingHomedAxes returns the axes of RequireHomed which are not homed.
+func (o *TinygController) MissingHomedAxes() (missing []string) {
+	o.homedLock.Lock()
+	defer o.homedLock.Unlock()
+	for _, axis := range strings.ToUpper(o.RequireHomed) {
+		if !o.homedAxes[string(axis)] {
+			missing = append(missing, string(axis))
+		}
+	}
+	return
+}
+
+// CheckHomed returns an error wrapping ErrNotHomed with the missing axes
+// if any axis of RequireHomed is not homed.
+func (o *TinygController) CheckHomed() error {
+	if missing := o.MissingHomedAxes(); len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotHomed, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// homingMachine answers status requests with the states in order, the
+// last state is repeated. failure is sent after the homing command.
+func homingMachine(failure string, states ...string) func(line string) []string {
+	return func(line string) []string {
+		switch {
+		case strings.HasPrefix(line, "G28.2") && failure != "":
+			return []string{failure, ackResponse}
+		case line == tgjson.CommandRequestStatus:
+			state := states[0]
+			if len(states) > 1 {
+				states = states[1:]
+			}
+			return []string{`{"r":{"sr":{"stat":` + state + `}},"f":[1,0,8]}`}
+		}
+		return ackLines(line)
+	}
+}
+
+func TestHome(t *testing.T) {
+	tg, port := newTestController(t, homingMachine("", "9", "3"))
+	tg.RequireHomed = "XYZ"
+	if err := tg.Home("x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); written[0] != "G28.2 X0 Y0" {
+		t.Error("Wrong homing command: ", written[0])
+	}
+	if err := tg.CheckHomed(); !errors.Is(err, ErrNotHomed) || !strings.HasSuffix(err.Error(), ": Z") {
+		t.Error("Wrong homed check: ", err)
+	}
+	tg.recordAlarm(tgjson.StatusLimitSwitchHit, "")
+	if homed := tg.HomedAxes(); len(homed) != 0 {
+		t.Error("Homed axes after a limit switch hit: ", homed)
+	}
+
+	tg, _ = newTestController(t, homingMachine(`{"er":{"fb":440.2,"st":240,"msg":"Homing cycle failed"}}`, "9", "2"))
+	tg.setHomed(true, "X", "Z")
+	err := tg.Home("Z")
+	var homingErr *HomingError
+	if !errors.As(err, &homingErr) || homingErr.Status != tgjson.StatusHomingCycleFailed {
+		t.Error("Wrong homing failure: ", err)
+	}
+	if homed := tg.HomedAxes(); !reflect.DeepEqual(homed, []string{"X"}) {
+		t.Error("Wrong homed axes after a failure: ", homed)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+package controller
+
+import (
+	"github.com/itschleemilch/huanyango/v1/vfdio"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle/hysim"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHuanyangAtSpeed runs a program with the VFD driver connected to the
+// simulated inverter, the program has to wait for the spindle ramp.
+func TestHuanyangAtSpeed(t *testing.T) {
+	master, slavePath, err := hysim.OpenPty()
+	if err != nil {
+		t.Skip("No pseudo-terminal available: ", err)
+	}
+	defer master.Close()
+	slave, err := os.OpenFile(slavePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("Could not open ", slavePath, ": ", err)
+	}
+	defer slave.Close()
+	sim := hysim.NewSimulator()
+	sim.Acceleration = 200
+	go sim.Serve(master)
+
+	vfd := vfdio.NewVfd()
+	vfd.Open(slavePath, 24000, sim.RpmPerHz, 50)
+	hy := spindle.NewHuanyang(vfd)
+	defer hy.Close()
+
+	var rampDone int32 = -1
+	tg, port := newTestController(t, func(line string) []string {
+		if line == "G0 X1" {
+			setpoint := sim.FrequencySetpoint()
+			if setpoint > 0 && sim.OutputFrequency() >= setpoint*(1-hy.Tolerance) {
+				atomic.StoreInt32(&rampDone, 1)
+			} else {
+				atomic.StoreInt32(&rampDone, 0)
+			}
+		}
+		return ackLines(line)
+	})
+	tg.Spindle = hy
+	tg.SpindleAtSpeedTimeout = 10 * time.Second
+	started := time.Now()
+	tg.queueJob([][]string{{"M3 S12000"}, {"G0 X1"}})
+	for deadline := started.Add(10 * time.Second); len(port.Written()) < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Program stuck, written %q", port.Written())
+		}
+	}
+	if atomic.LoadInt32(&rampDone) != 1 || time.Since(started) < 500*time.Millisecond {
+		t.Error("Program continued before the VFD was at speed")
+	}
+	if alarms := tg.Alarms(0); len(alarms) > 0 {
+		t.Error("Alarms while waiting for the VFD: ", alarms)
+	}
+}
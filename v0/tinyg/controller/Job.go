@@ -0,0 +1,194 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/golang/glog"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// jobSettleTime is the minimum time after the last transmitted line before
+// a job is considered finished, TinyG reports the motion with a delay.
+const jobSettleTime time.Duration = time.Second
+
+// TJobOutcome is the result of a job.
+type TJobOutcome string
+
+const (
+	JobRunning   TJobOutcome = "running"
+	JobCompleted TJobOutcome = "completed"
+	JobCancelled TJobOutcome = "cancelled" // flushed by the operator
+	JobAlarmed   TJobOutcome = "alarmed"   // alarms were recorded while running
+)
+
+// TJob is a program run started by RunJob.
+type TJob struct {
+	Id        int           `json:"id"`
+	Name      string        `json:"name"`
+	Hash      string        `json:"hash"` // SHA-256 of the program
+	Lines     int           `json:"lines"`
+	LinesDone int           `json:"linesDone"` // acknowledged by TinyG
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Outcome   TJobOutcome   `json:"outcome"`
+	Alarms    []TAlarmEvent `json:"alarms"`
+	// Work coordinate system, its offset and G92 at the start
+	CoordinateSystem string                    `json:"cs"`
+	Offsets          map[string]tgjson.TOffset `json:"offsets"`
+	Tool             int                       `json:"tool"`
+}
+
+// ProgramHash returns the hash of a program as stored in TJob. The lines
+// are hashed without line endings, joined by newlines.
+func ProgramHash(lines []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// RunJob queues a program as job. name identifies the program, e.g. the
+// file name.
+func (o *TinygController) RunJob(name string, lines []string) (job TJob, err error) {
+	if err = o.CheckHomed(); err != nil {
+		return
+	}
+	hash := ProgramHash(lines)
+	leveled, err := o.levelJob(lines)
+	if err != nil {
+		return
+	}
+	cs, offsets := o.jobOffsets()
+	tool := o.currentTool()
+	if o.Tools != nil {
+		tool, _ = o.Tools.Active()
+	}
+	// The check and the start are atomic, only one job starts
+	o.jobLock.Lock()
+	if o.JobRunning() {
+		o.jobLock.Unlock()
+		return job, ErrJobRunning
+	}
+	o.jobSeq++
+	o.job = &TJob{
+		Id:               o.jobSeq,
+		Name:             name,
+		Hash:             hash,
+		Lines:            len(lines),
+		Start:            time.Now(),
+		Outcome:          JobRunning,
+		CoordinateSystem: cs,
+		Offsets:          offsets,
+		Tool:             tool,
+	}
+	o.jobFirstAlarm = o.lastAlarmId()
+	job = *o.job
+	atomic.StoreInt32(&o.jobLinesDone, 0)
+	o.markJobActive()
+	o.jobLock.Unlock()
+	glog.Infoln("Job #", job.Id, " started: ", name, " (", len(lines), " lines)")
+	o.enqueue(jobEntries(leveled), true)
+	return
+}
+
+// jobOffsets returns the active coordinate system with its offset and G92.
+func (o *TinygController) jobOffsets() (cs string, offsets map[string]tgjson.TOffset) {
+	all := o.WorkOffsets()
+	offsets = make(map[string]tgjson.TOffset)
+	if p, err := o.activeCoordinateSystem(); err == nil {
+		cs = tgjson.TCoordinateSystem(p).String()
+		if offset, ok := all[cs]; ok {
+			offsets[cs] = offset
+		}
+	}
+	if offset, ok := all["G92"]; ok {
+		offsets["G92"] = offset
+	}
+	return
+}
+
+// ContinueJobIds lets the ids of new jobs follow lastId, e.g. the last
+// id of a persisted job history.
+func (o *TinygController) ContinueJobIds(lastId int) {
+	o.jobLock.Lock()
+	defer o.jobLock.Unlock()
+	if lastId > o.jobSeq {
+		o.jobSeq = lastId
+	}
+}
+
+// CurrentJob returns the running or the last finished job.
+func (o *TinygController) CurrentJob() (job TJob, ok bool) {
+	o.jobLock.Lock()
+	defer o.jobLock.Unlock()
+	if o.job == nil {
+		return
+	}
+	job = *o.job
+	if job.Outcome == JobRunning {
+		job.LinesDone = int(atomic.LoadInt32(&o.jobLinesDone))
+		job.Alarms = o.Alarms(o.jobFirstAlarm)
+	}
+	return job, true
+}
+
+// acknowledge handles the answer of TinyG to the oldest unanswered line.
+func (o *TinygController) acknowledge(status tgjson.TResponseStatusCode) {
+	o.ackLock.Lock()
+	if len(o.pendingAcks) == 0 {
+		o.ackLock.Unlock()
+		return
+	}
+	ack := o.pendingAcks[0]
+	o.pendingAcks = o.pendingAcks[1:]
+	o.ackLock.Unlock()
+	if ack.status != nil {
+		ack.status <- status
+	}
+	o.jobLineDone(ack.jobLine)
+}
+
+// jobLineDone counts a line of the job program as done.
+func (o *TinygController) jobLineDone(jobLine bool) {
+	if jobLine {
+		atomic.AddInt32(&o.jobLinesDone, 1)
+	}
+}
+
+// finishJob records the end of the running job. Jobs with alarms are
+// reported as alarmed, independent of how they ended.
+func (o *TinygController) finishJob(outcome TJobOutcome) {
+	o.jobLock.Lock()
+	defer o.jobLock.Unlock()
+	if o.job == nil || o.job.Outcome != JobRunning {
+		return
+	}
+	o.job.End = time.Now()
+	o.job.LinesDone = int(atomic.LoadInt32(&o.jobLinesDone))
+	o.job.Alarms = o.Alarms(o.jobFirstAlarm)
+	if len(o.job.Alarms) > 0 {
+		outcome = JobAlarmed
+	}
+	o.job.Outcome = outcome
+	glog.Infoln("Job #", o.job.Id, " ", outcome, " after ", o.job.LinesDone, " of ", o.job.Lines, " lines")
+	if o.JobFinished != nil {
+		go o.JobFinished(*o.job)
+	}
+}
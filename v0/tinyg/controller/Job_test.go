@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestJobLinesCountedOnAnswer(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	// The first program line is split into two moves, the third is a comment
+	tg.queueJob([][]string{{"G1 X1", "G1 X2"}, {"G1 X3"}, {""}})
+	waitFor(t, "transmission", func() bool { return len(port.Written()) == 3 })
+	tg.writeDirect("{sr:n}")
+	done := func() int32 { return atomic.LoadInt32(&tg.jobLinesDone) }
+	waitFor(t, "the empty line", func() bool { return done() == 1 })
+	expected := []int32{1, 2, 3, 3} // the last answer belongs to the status request
+	for n, count := range expected {
+		port.Send(ackResponse)
+		waitFor(t, "answer", func() bool {
+			tg.ackLock.Lock()
+			defer tg.ackLock.Unlock()
+			return len(tg.pendingAcks) == len(expected)-n-1
+		})
+		if done() != count {
+			t.Errorf("Answer %d: %d lines done, expected %d", n+1, done(), count)
+		}
+	}
+}
+
+func TestRunJobStartsOnce(t *testing.T) {
+	tg, _ := newTestController(t, ackLines)
+	var started int32
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tg.RunJob("part.nc", []string{"T2", "G0 X1"}); err == nil {
+				atomic.AddInt32(&started, 1)
+			} else if err != ErrJobRunning {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if job, _ := tg.CurrentJob(); started != 1 || job.Id != 1 || job.Hash != ProgramHash([]string{"T2", "G0 X1"}) {
+		t.Error("Jobs started: ", started, job)
+	}
+	waitFor(t, "the tool selection", func() bool { return tg.currentTool() == 2 })
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"strings"
+	"time"
+)
+
+const (
+	jogContinuousDistance float64       = 1000.0 // far enough, the move is stopped by JogStop or limits
+	jogWatchdogTimeout    time.Duration = 500 * time.Millisecond
+)
+
+var (
+	ErrJobRunning  = errors.New("a job is running")
+	ErrInvalidAxis = errors.New("invalid axis")
+	ErrInvalidFeed = errors.New("feed rate has to be positive")
+)
+
+// normalizeAxis checks the axis name and returns it in upper case.
+func normalizeAxis(axis string) (string, error) {
+	axis = strings.ToUpper(strings.TrimSpace(axis))
+	switch axis {
+	case "X", "Y", "Z", "A":
+		return axis, nil
+	}
+	return "", ErrInvalidAxis
+}
+
+// relativeMove sends a G91 move and restores the previous distance mode.
+func (o *TinygController) relativeMove(axis string, distance, feed float64) {
+	o.writeDirect(fmt.Sprintf("G91 G1 %s%.4f F%.1f", axis, distance, feed))
+	if sr := o.statusReport(); sr.DistanceMode == nil || *sr.DistanceMode == tgjson.DistanceAbsolute {
+		o.writeDirect("G90")
+	}
+}
+
+// Jog moves a single axis by distance with the given feed rate.
+// It is refused while a job is running.
+func (o *TinygController) Jog(axis string, distance, feed float64) (err error) {
+	if axis, err = normalizeAxis(axis); err != nil {
+		return
+	}
+	if feed <= 0 {
+		return ErrInvalidFeed
+	}
+	if !o.jogAllowed() {
+		return ErrJobRunning
+	}
+	if distance, err = o.limitJog(axis, distance, false); err != nil {
+		return
+	}
+	o.relativeMove(axis, distance, feed)
+	return
+}
+
+// JogStart starts a continuous move of an axis in positive (direction > 0)
+// or negative direction. The move is stopped by JogStop or if JogStart
+// has not been called again within the watchdog timeout, so clients
+// have to repeat the call as keep-alive while the jog key is pressed.
+func (o *TinygController) JogStart(axis string, direction int, feed float64) (err error) {
+	if axis, err = normalizeAxis(axis); err != nil {
+		return
+	}
+	if feed <= 0 {
+		return ErrInvalidFeed
+	}
+	if !o.jogAllowed() {
+		return ErrJobRunning
+	}
+	distance := jogContinuousDistance
+	if direction < 0 {
+		distance = -distance
+	}
+	o.jogLock.Lock()
+	defer o.jogLock.Unlock()
+	if o.jogWatchdog != nil {
+		if o.jogMove == fmt.Sprint(axis, distance, feed) {
+			o.jogWatchdog.Reset(jogWatchdogTimeout) // keep-alive
+			return
+		}
+		o.stopJogging()
+	}
+	move, err := o.limitJog(axis, distance, true) // stop at the envelope
+	if err != nil {
+		return
+	}
+	o.relativeMove(axis, move, feed)
+	o.jogMove = fmt.Sprint(axis, distance, feed)
+	o.jogWatchdog = time.AfterFunc(jogWatchdogTimeout, func() {
+		glog.Warningln("Jog watchdog expired, stopping")
+		o.JogStop()
+	})
+	return
+}
+
+// jogAllowed is true while no program is running or a running program
+// waits for a tool change.
+func (o *TinygController) jogAllowed() bool {
+	return !o.JobRunning() || o.ToolChangeState().Pending
+}
+
+// JogStop stops a continuous jog using feed hold and a queue flush.
+func (o *TinygController) JogStop() error {
+	o.jogLock.Lock()
+	defer o.jogLock.Unlock()
+	if o.jogWatchdog != nil {
+		o.stopJogging()
+	}
+	return nil
+}
+
+func (o *TinygController) stopJogging() {
+	o.jogWatchdog.Stop()
+	o.jogWatchdog = nil
+	o.jogMove = ""
+	o.portWrite([]byte(tgjson.CommandFeedHold))
+	time.Sleep(50 * time.Millisecond) // let the planner enter hold before flushing
+	o.portWrite([]byte(tgjson.CommandQueueFlush))
+}
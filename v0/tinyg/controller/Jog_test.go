@@ -0,0 +1,56 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJog(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	if err := tg.Jog("B", 1, 100); err != ErrInvalidAxis {
+		t.Error("Invalid axis accepted: ", err)
+	}
+	if err := tg.Jog("X", 1, 0); err != ErrInvalidFeed {
+		t.Error("Invalid feed accepted: ", err)
+	}
+	if err := tg.Jog(" x ", -0.5, 100); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); !reflect.DeepEqual(written, []string{"G91 G1 X-0.5000 F100.0", "G90"}) {
+		t.Error("Wrong jog: ", written)
+	}
+
+	tg.Envelope = TEnvelope{Max: tgjson.TOffset{X: 100}}
+	if err := tg.Jog("X", 1, 100); err != ErrMachinePositionUnset {
+		t.Error("Jog without position: ", err)
+	}
+	setState(t, tg, `{"r":{"mpo":{"x":10}},"f":[1,0,8]}`)
+	if err := tg.Jog("X", 95, 100); err != ErrOutsideEnvelope {
+		t.Error("Jog outside of the envelope: ", err)
+	}
+	atomic.StoreInt32(&tg.jobActive, 1)
+	if err := tg.Jog("Y", 1, 100); err != ErrJobRunning {
+		t.Error("Jog during a job: ", err)
+	}
+}
+
+func TestJogWatchdog(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	setState(t, tg, `{"r":{"mpo":{"x":10}},"f":[1,0,8]}`)
+	tg.Envelope = TEnvelope{Max: tgjson.TOffset{X: 100}}
+	started := time.Now()
+	tg.JogStart("X", 1, 500)
+	time.Sleep(jogWatchdogTimeout / 2)
+	tg.JogStart("X", 1, 500) // keep-alive
+	waitFor(t, "the watchdog", func() bool { return len(port.Written()) == 4 })
+	if time.Since(started) < jogWatchdogTimeout*3/2 {
+		t.Error("Keep-alive did not reset the watchdog")
+	}
+	// The move is clamped at the envelope and stopped by feed hold and flush
+	if written := port.Written(); !reflect.DeepEqual(written, []string{"G91 G1 X90.0000 F500.0", "G90", "!", "%"}) {
+		t.Error("Wrong continuous jog: ", written)
+	}
+}
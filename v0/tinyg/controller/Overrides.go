@@ -0,0 +1,104 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+)
+
+const (
+	OverrideMin         float64 = 10
+	OverrideMax         float64 = 200
+	TraverseOverrideMax float64 = 100
+)
+
+var ErrInvalidOverride = errors.New("override out of range")
+
+// TOverrides holds the manual overrides in percent.
+type TOverrides struct {
+	Feed     float64 `json:"feed"`
+	Traverse float64 `json:"traverse"`
+	Spindle  float64 `json:"spindle"`
+}
+
+func defaultOverrides() TOverrides {
+	return TOverrides{Feed: 100, Traverse: 100, Spindle: 100}
+}
+
+// Overrides returns the current overrides.
+func (o *TinygController) Overrides() TOverrides {
+	o.spindleLock.Lock()
+	defer o.spindleLock.Unlock()
+	return o.overrides
+}
+
+// SetFeedOverride scales the programmed feed rates using TinyG's
+// manual feed rate override (mfo).
+func (o *TinygController) SetFeedOverride(percent float64) error {
+	if percent < OverrideMin || percent > OverrideMax {
+		return ErrInvalidOverride
+	}
+	o.writeDirect(tgjson.CommandSetFeedOverride(percent / 100))
+	o.writeDirect(tgjson.CommandRequestFeedOverride)
+	o.spindleLock.Lock()
+	o.overrides.Feed = percent
+	o.spindleLock.Unlock()
+	return nil
+}
+
+// SetTraverseOverride scales the speed of G0 moves using TinyG's
+// manual traverse override (mto). Traverses can not be faster than
+// the machine's maximum velocity, so the override is limited to 100%.
+func (o *TinygController) SetTraverseOverride(percent float64) error {
+	if percent < OverrideMin || percent > TraverseOverrideMax {
+		return ErrInvalidOverride
+	}
+	o.writeDirect(tgjson.CommandSetTraverseOverride(percent / 100))
+	o.writeDirect(tgjson.CommandRequestTraverseOverride)
+	o.spindleLock.Lock()
+	o.overrides.Traverse = percent
+	o.spindleLock.Unlock()
+	return nil
+}
+
+// SetSpindleOverride scales the speed sent to the spindle driver. A
+// running spindle is updated immediately. The override does not affect
+// TinyG's own PWM output.
+func (o *TinygController) SetSpindleOverride(percent float64) error {
+	if percent < OverrideMin || percent > OverrideMax {
+		return ErrInvalidOverride
+	}
+	o.spindleLock.Lock()
+	defer o.spindleLock.Unlock()
+	o.overrides.Spindle = percent
+	if o.Spindle == nil || o.spindleState.Direction == spindle.DirectionStop {
+		return nil
+	}
+	return o.updateSpindle()
+}
+
+// updateSpindle sends the commanded spindle state scaled by the spindle
+// override to the spindle driver, requires spindleLock.
+func (o *TinygController) updateSpindle() error {
+	state := o.spindleState
+	if o.overrides.Spindle > 0 {
+		state.Rpm *= o.overrides.Spindle / 100
+	}
+	return state.Update(o.Spindle)
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"reflect"
+	"testing"
+)
+
+func TestOverrides(t *testing.T) {
+	tg, port := newTestController(t, nil)
+	for _, percent := range []float64{OverrideMin - 1, OverrideMax + 1} {
+		if tg.SetFeedOverride(percent) != ErrInvalidOverride || tg.SetSpindleOverride(percent) != ErrInvalidOverride {
+			t.Errorf("Override of %v%% accepted", percent)
+		}
+	}
+	if err := tg.SetTraverseOverride(TraverseOverrideMax + 1); err != ErrInvalidOverride {
+		t.Error("Traverse override above 100% accepted: ", err)
+	}
+	tg.SetFeedOverride(150)
+	tg.SetTraverseOverride(50)
+	if written := port.Written(); !reflect.DeepEqual(written, []string{"{mfo:1.500}", "{mfo:n}", "{mto:0.500}", "{mto:n}"}) {
+		t.Errorf("Written %q", written)
+	}
+
+	sim := spindle.NewSimulated(0)
+	tg.Spindle = sim
+	tg.SetSpindleOverride(50)
+	if rpm, direction := sim.Setpoint(); rpm != 0 || direction != spindle.DirectionStop {
+		t.Error("Stopped spindle started by the override: ", rpm)
+	}
+	tg.handleSpindleCommand("M3 S12000")
+	tg.SetSpindleOverride(80)
+	if rpm, _ := sim.Setpoint(); rpm != 9600 {
+		t.Error("Override not applied to the running spindle: ", rpm)
+	}
+	if overrides := tg.Overrides(); overrides != (TOverrides{Feed: 150, Traverse: 50, Spindle: 80}) {
+		t.Error("Wrong overrides: ", overrides)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"time"
+)
+
+const probeTimeout time.Duration = 2 * time.Minute
+
+var ErrInvalidProbeDistance = errors.New("probe distance has to be positive")
+
+// TProbeFailure describes why a probing move has failed.
+type TProbeFailure int
+
+const (
+	ProbeNotTriggered TProbeFailure = 1
+	ProbeTimeout      TProbeFailure = 2
+	ProbeAlarm        TProbeFailure = 3
+	ProbeInvalidState TProbeFailure = 4
+)
+
+// ProbeError is returned by all probing functions if the probe
+// could not be completed.
+type ProbeError struct {
+	Failure TProbeFailure
+	Status  tgjson.TResponseStatusCode // set for ProbeAlarm
+	Message string
+}
+
+func (e *ProbeError) Error() string {
+	return "probing failed: " + e.Message
+}
+
+// TProbeSettings holds the parameters shared by the high level probing routines.
+type TProbeSettings struct {
+	MaxDistance    float64 `json:"maxDistance"`    // maximum travel of a single probe move
+	Feed           float64 `json:"feed"`           // probing feed rate
+	Retract        float64 `json:"retract"`        // distance to back off after contact
+	Diameter       float64 `json:"diameter"`       // probe tip diameter, used for edge finding
+	PlateThickness float64 `json:"plateThickness"` // touch plate thickness, used for Z touch-off
+}
+
+// offsetAxis returns the value of an axis ("X", "Y" or "Z") of a position.
+func offsetAxis(pos tgjson.TOffset, axis string) float64 {
+	switch axis {
+	case "X":
+		return pos.X
+	case "Y":
+		return pos.Y
+	case "Z":
+		return pos.Z
+	}
+	return 0
+}
+
+// Probe runs a G38.2 move of a single axis towards direction (+1 or -1)
+// for at most maxDistance. It returns the trigger position in machine
+// coordinates or a *ProbeError.
+func (o *TinygController) Probe(axis string, direction int, maxDistance, feed float64) (pos tgjson.TOffset, err error) {
+	if axis, err = normalizeAxis(axis); err != nil {
+		return
+	}
+	if o.JobRunning() {
+		err = ErrJobRunning
+		return
+	}
+	return o.probe(axis, direction, maxDistance, feed)
+}
+
+// probe implements Probe without checking for a running job, so
+// it can be used from within a job, e.g. during a tool change.
+func (o *TinygController) probe(axis string, direction int, maxDistance, feed float64) (pos tgjson.TOffset, err error) {
+	switch {
+	case axis == "A":
+		err = ErrInvalidAxis
+		return
+	case maxDistance <= 0:
+		err = ErrInvalidProbeDistance
+		return
+	case feed <= 0:
+		err = ErrInvalidFeed
+		return
+	}
+	if state, _ := o.machineState(); state == tgjson.StateAlarm || state == tgjson.StateProbe {
+		err = &ProbeError{Failure: ProbeInvalidState, Message: "machine state is " + state.String()}
+		return
+	}
+	distance := maxDistance
+	if direction < 0 {
+		distance = -distance
+	}
+	o.stateLock.RLock()
+	probeSeq := o.probeSeq
+	o.stateLock.RUnlock()
+	alarmsBefore := o.lastAlarmId()
+
+	answer := o.writeDirectAnswered(fmt.Sprintf("G91 G38.2 %s%.4f F%.1f", axis, distance, feed))
+	if sr := o.statusReport(); sr.DistanceMode == nil || *sr.DistanceMode == tgjson.DistanceAbsolute {
+		o.writeDirect("G90")
+	}
+
+	var report tgjson.TProbeReport
+	deadline := time.Now().Add(probeTimeout)
+	for {
+		o.stateLock.RLock()
+		received := o.probeSeq != probeSeq
+		report = o.lastProbe
+		o.stateLock.RUnlock()
+		if received {
+			break
+		}
+		for _, event := range o.Alarms(alarmsBefore) {
+			err = &ProbeError{Failure: ProbeAlarm, Status: event.Status, Message: event.Message}
+			return
+		}
+		select {
+		case status := <-answer:
+			if status != tgjson.StatusOk { // the move has been rejected
+				err = &ProbeError{Failure: ProbeAlarm, Status: status, Message: status.Message()}
+				return
+			}
+		default:
+		}
+		if time.Now().After(deadline) {
+			o.FeedHold()
+			err = &ProbeError{Failure: ProbeTimeout, Message: "no probe report received"}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// The report may arrive before the machine has come to a stop
+	o.waitForState(func(state tgjson.TMachineState) bool { return state != tgjson.StateProbe }, probeTimeout)
+	if !report.Ok() {
+		err = &ProbeError{Failure: ProbeNotTriggered, Message: "probe did not trigger within " + fmt.Sprint(maxDistance)}
+		return
+	}
+	pos = report.TOffset
+	return
+}
+
+// activeCoordinateSystem returns the P number (1 for G54 ... 6 for G59)
+// of the selected work coordinate system for use with G10.
+func (o *TinygController) activeCoordinateSystem() (p int, err error) {
+	sr := o.statusReport()
+	if sr.CoordinateSystem == nil || *sr.CoordinateSystem == tgjson.CoordinateSystemG53 {
+		err = &ProbeError{Failure: ProbeInvalidState, Message: "no work coordinate system selected"}
+		return
+	}
+	return int(*sr.CoordinateSystem), nil
+}
+
+// setWorkZero sets the origin of an axis of the active work coordinate
+// system to the machine position machinePos (G10 L2).
+func (o *TinygController) setWorkZero(axis string, machinePos float64) error {
+	p, err := o.activeCoordinateSystem()
+	if err != nil {
+		return err
+	}
+	o.writeDirect(fmt.Sprintf("G10 L2 P%d %s%.4f", p, axis, machinePos))
+	return nil
+}
+
+// ProbeZTouchOff probes downwards onto a touch plate and sets the work
+// zero of Z to the surface below the plate. Returns the machine Z of
+// the surface.
+func (o *TinygController) ProbeZTouchOff(settings TProbeSettings) (surface float64, err error) {
+	pos, err := o.Probe("Z", -1, settings.MaxDistance, settings.Feed)
+	if err != nil {
+		return
+	}
+	surface = pos.Z - settings.PlateThickness
+	if err = o.setWorkZero("Z", surface); err != nil {
+		return
+	}
+	o.relativeMove("Z", settings.Retract, settings.Feed)
+	return
+}
+
+// FindEdge probes a single axis towards an edge of the work piece and
+// returns the machine position of the edge, corrected by the probe radius.
+// If setZero is true the edge becomes the work zero of the axis.
+func (o *TinygController) FindEdge(axis string, direction int, settings TProbeSettings, setZero bool) (edge float64, err error) {
+	pos, err := o.Probe(axis, direction, settings.MaxDistance, settings.Feed)
+	if err != nil {
+		return
+	}
+	axis, _ = normalizeAxis(axis)
+	sign := 1.0
+	if direction < 0 {
+		sign = -1.0
+	}
+	edge = offsetAxis(pos, axis) + sign*settings.Diameter/2
+	o.relativeMove(axis, -sign*settings.Retract, settings.Feed)
+	if setZero {
+		err = o.setWorkZero(axis, edge)
+	}
+	return
+}
+
+// FindCorner locates an outside corner. The probe has to be lowered below
+// the top surface and placed diagonally outside the corner, clearance
+// away from both faces. xDir and yDir point from the probe to the work piece.
+func (o *TinygController) FindCorner(xDir, yDir int, clearance float64, settings TProbeSettings, setZero bool) (corner tgjson.TOffset, err error) {
+	xSign, ySign := 1.0, 1.0
+	if xDir < 0 {
+		xSign = -1.0
+	}
+	if yDir < 0 {
+		ySign = -1.0
+	}
+	if o.JobRunning() {
+		err = ErrJobRunning
+		return
+	}
+	// Move alongside the face perpendicular to X and probe it
+	o.relativeMove("Y", ySign*2*clearance, settings.Feed)
+	if corner.X, err = o.FindEdge("X", xDir, settings, false); err != nil {
+		return
+	}
+	o.relativeMove("Y", -ySign*2*clearance, settings.Feed)
+	// Move alongside the face perpendicular to Y and probe it
+	o.writeDirect(fmt.Sprintf("G53 G1 X%.4f F%.1f", corner.X+xSign*clearance, settings.Feed))
+	if corner.Y, err = o.FindEdge("Y", yDir, settings, false); err != nil {
+		return
+	}
+	if setZero {
+		if err = o.setWorkZero("X", corner.X); err != nil {
+			return
+		}
+		err = o.setWorkZero("Y", corner.Y)
+	}
+	return
+}
+
+// FindCenter locates the center of a bore or pocket by probing both walls
+// in X and Y. The probe has to be lowered into the bore. It is moved to
+// the center afterwards.
+func (o *TinygController) FindCenter(settings TProbeSettings, setZero bool) (center tgjson.TOffset, err error) {
+	for _, axis := range []string{"X", "Y"} {
+		var upper, lower tgjson.TOffset
+		if upper, err = o.Probe(axis, 1, settings.MaxDistance, settings.Feed); err != nil {
+			return
+		}
+		o.relativeMove(axis, -settings.Retract, settings.Feed)
+		if lower, err = o.Probe(axis, -1, settings.MaxDistance, settings.Feed); err != nil {
+			return
+		}
+		middle := (offsetAxis(upper, axis) + offsetAxis(lower, axis)) / 2
+		o.writeDirect(fmt.Sprintf("G53 G1 %s%.4f F%.1f", axis, middle, settings.Feed))
+		if axis == "X" {
+			center.X = middle
+		} else {
+			center.Y = middle
+		}
+		if setZero {
+			if err = o.setWorkZero(axis, middle); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"errors"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeRejected(t *testing.T) {
+	tg, port := newTestController(t, func(line string) []string {
+		if strings.Contains(line, "G38.2") {
+			return []string{`{"r":{},"f":[1,101,20]}`}
+		}
+		return ackLines(line)
+	})
+	if _, err := tg.Probe("Z", -1, 0, 100); err != ErrInvalidProbeDistance {
+		t.Error("Probe without distance accepted: ", err)
+	}
+	if _, err := tg.Probe("Z", -1, 10, -1); err != ErrInvalidFeed || len(port.Written()) > 0 {
+		t.Error("Probe with negative feed accepted: ", err)
+	}
+	started := time.Now()
+	_, err := tg.Probe("Z", -1, 10, 100)
+	var probeErr *ProbeError
+	if !errors.As(err, &probeErr) || probeErr.Status != tgjson.StatusInvalidOrMalformedCommand {
+		t.Error("Wrong error of a rejected probe: ", err)
+	}
+	if time.Since(started) > time.Second {
+		t.Error("Rejected probe not detected immediately")
+	}
+}
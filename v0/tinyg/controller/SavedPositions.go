@@ -0,0 +1,189 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SavedPositionG28 string = "g28"
+	SavedPositionG30 string = "g30"
+)
+
+var (
+	ErrNoSuchPosition       = errors.New("no such saved position")
+	ErrPositionReadOnly     = errors.New("saved position is read-only")
+	ErrInvalidPositionName  = errors.New("invalid position name")
+	ErrMachinePositionUnset = errors.New("machine position unknown")
+	ErrPositionNotReported  = errors.New("saved position not reported by TinyG yet")
+)
+
+// TSavedPositions is a persisted list of named positions in machine
+// coordinates, e.g. "park", "toolchange" or "load".
+type TSavedPositions struct {
+	path      string
+	lock      sync.Mutex
+	positions map[string]tgjson.TOffset
+}
+
+// LoadSavedPositions reads the positions stored at path.
+// A missing file results in an empty list.
+func LoadSavedPositions(path string) (positions *TSavedPositions, err error) {
+	positions = &TSavedPositions{path: path, positions: make(map[string]tgjson.TOffset)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return positions, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &positions.positions); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (o *TSavedPositions) save() error {
+	data, err := json.MarshalIndent(o.positions, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(o.path, data, 0644)
+}
+
+// Get returns a stored position.
+func (o *TSavedPositions) Get(name string) (pos tgjson.TOffset, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	pos, ok = o.positions[strings.ToLower(name)]
+	return
+}
+
+// Set stores a position and persists the list.
+func (o *TSavedPositions) Set(name string, pos tgjson.TOffset) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return ErrInvalidPositionName
+	}
+	if name == SavedPositionG28 || name == SavedPositionG30 {
+		return ErrPositionReadOnly
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.positions[name] = pos
+	return o.save()
+}
+
+// Delete removes a position and persists the list.
+func (o *TSavedPositions) Delete(name string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	name = strings.ToLower(name)
+	if _, ok := o.positions[name]; !ok {
+		return ErrNoSuchPosition
+	}
+	delete(o.positions, name)
+	return o.save()
+}
+
+// Names returns the sorted names of all stored positions.
+func (o *TSavedPositions) Names() (names []string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for name := range o.positions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// SavedPositions returns all named positions including the G28 and G30
+// positions stored in TinyG, as far as TinyG has reported them.
+func (o *TinygController) SavedPositions() (positions map[string]tgjson.TOffset) {
+	positions = make(map[string]tgjson.TOffset)
+	if o.Positions != nil {
+		for _, name := range o.Positions.Names() {
+			positions[name], _ = o.Positions.Get(name)
+		}
+	}
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
+	if o.reports[SavedPositionG28] > 0 {
+		positions[SavedPositionG28] = *o.tinygState.ResponseData.SavedPositionG28
+	}
+	if o.reports[SavedPositionG30] > 0 {
+		positions[SavedPositionG30] = *o.tinygState.ResponseData.SavedPositionG30
+	}
+	return
+}
+
+// RefreshSavedPositions requests the G28 and G30 positions from TinyG
+// and waits until TinyG has reported them.
+func (o *TinygController) RefreshSavedPositions() error {
+	return o.requestReports(SavedPositionG28, SavedPositionG30)
+}
+
+// SaveCurrentPosition requests the current machine position from TinyG
+// and stores it under name.
+func (o *TinygController) SaveCurrentPosition(name string) error {
+	if o.Positions == nil {
+		return ErrNoSuchPosition
+	}
+	if err := o.requestReports("mpo"); err != nil {
+		return ErrMachinePositionUnset
+	}
+	o.stateLock.RLock()
+	pos := *o.tinygState.ResponseData.AbsoluteMachinePosition
+	o.stateLock.RUnlock()
+	return o.Positions.Set(name, pos)
+}
+
+// MoveToSavedPosition moves safely to a named position: Z is retracted
+// to safeZ first, then X and Y are moved and finally Z is lowered to
+// the stored height. All moves are done in machine coordinates (G53).
+func (o *TinygController) MoveToSavedPosition(name string, safeZ float64) error {
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	return o.moveToSavedPosition(name, safeZ)
+}
+
+func (o *TinygController) moveToSavedPosition(name string, safeZ float64) error {
+	name = strings.ToLower(name)
+	pos, ok := o.SavedPositions()[name]
+	if !ok && (name == SavedPositionG28 || name == SavedPositionG30) {
+		return ErrPositionNotReported
+	} else if !ok {
+		return ErrNoSuchPosition
+	}
+	if !o.Envelope.Contains(pos) || !o.Envelope.ContainsAxis("Z", safeZ) {
+		return ErrOutsideEnvelope
+	}
+	o.writeDirect("G53 G0 Z" + gcode.FormatNumber(safeZ))
+	o.writeDirect(fmt.Sprintf("G53 G0 X%s Y%s", gcode.FormatNumber(pos.X), gcode.FormatNumber(pos.Y)))
+	o.writeDirect("G53 G0 Z" + gcode.FormatNumber(pos.Z))
+	return nil
+}
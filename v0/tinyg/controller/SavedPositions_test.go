@@ -0,0 +1,85 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSavedPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "positions.json")
+	positions, err := LoadSavedPositions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"G28", "g30", " "} {
+		if err := positions.Set(name, tgjson.TOffset{}); err == nil {
+			t.Errorf("Position %q accepted", name)
+		}
+	}
+	positions.Set("Park", tgjson.TOffset{X: 10, Y: 20.5, Z: -30})
+	positions.Set("load", tgjson.TOffset{X: 400})
+	if positions, err = LoadSavedPositions(path); err != nil {
+		t.Fatal(err)
+	}
+	if names := positions.Names(); !reflect.DeepEqual(names, []string{"load", "park"}) {
+		t.Error("Wrong positions after loading: ", names)
+	}
+
+	tg, port := newTestController(t, nil)
+	tg.Positions = positions
+	tg.Envelope = TEnvelope{Min: tgjson.TOffset{Z: -50}, Max: tgjson.TOffset{X: 300, Y: 200}}
+	if err := tg.MoveToSavedPosition("load", -1); err != ErrOutsideEnvelope {
+		t.Error("Moved outside of the envelope: ", err)
+	}
+	if err := tg.MoveToSavedPosition("PARK", -1); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"G53 G0 Z-1.0000", "G53 G0 X10.0000 Y20.5000", "G53 G0 Z-30.0000"}
+	if written := port.Written(); !reflect.DeepEqual(written, expected) {
+		t.Error("Wrong safe move: ", written)
+	}
+}
+
+func TestTinygPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tg, port := newTestController(t, func(line string) []string {
+		switch line {
+		case "{mpo:n}":
+			return []string{`{"r":{"mpo":{"x":12,"y":34,"z":-5}},"f":[1,0,8]}`}
+		case "{g28:n}":
+			return []string{`{"r":{"g28":{"x":0,"y":0,"z":0}},"f":[1,0,8]}`}
+		case "{g30:n}":
+			return []string{`{"r":{"g30":{"x":100,"y":50,"z":0}},"f":[1,0,8]}`}
+		}
+		return ackLines(line)
+	})
+	tg.Positions, _ = LoadSavedPositions(filepath.Join(dir, "positions.json"))
+	if err := tg.MoveToSavedPosition("G30", 0); err != ErrPositionNotReported || len(port.Written()) > 0 {
+		t.Error("Moved to an unknown G30 position: ", err)
+	}
+	if err := tg.SaveCurrentPosition("here"); err != nil {
+		t.Fatal(err)
+	}
+	if pos, _ := tg.Positions.Get("here"); pos != (tgjson.TOffset{X: 12, Y: 34, Z: -5}) {
+		t.Error("Wrong position saved: ", pos)
+	}
+	if err := tg.RefreshSavedPositions(); err != nil {
+		t.Fatal(err)
+	}
+	if pos, ok := tg.SavedPositions()["g30"]; !ok || pos.X != 100 {
+		t.Error("G30 not read: ", pos)
+	}
+}
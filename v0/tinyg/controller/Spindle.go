@@ -0,0 +1,120 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spindlePollInterval    time.Duration = 50 * time.Millisecond
+	spindleMonitorInterval time.Duration = 500 * time.Millisecond
+)
+
+// handleSpindleCommand tracks the spindle words of a line and passes
+// changes to the spindle driver, if one is connected. If the spindle
+// has been started or its speed changed, the program is held back until
+// the spindle is at speed.
+func (o *TinygController) handleSpindleCommand(cmd string) {
+	if gcode.IsJson(cmd) {
+		return
+	}
+	o.spindleLock.Lock()
+	if !o.spindleState.Apply(gcode.ParseLine(cmd)) || o.Spindle == nil {
+		o.spindleLock.Unlock()
+		return
+	}
+	err := o.updateSpindle()
+	o.spindleLock.Unlock()
+	if err != nil {
+		glog.Errorln("Spindle error: ", err)
+		return
+	}
+	if o.spindleState.Direction != spindle.DirectionStop && o.SpindleAtSpeedTimeout > 0 {
+		o.waitSpindleAtSpeed()
+	}
+}
+
+// spindleMonitor samples the spindle while a job runs. If the drive
+// reports a fault or the speed drops below SpindleStallPercent of the
+// setpoint after the spindle has been at speed, a feed hold is sent and
+// an alarm is recorded. The monitor is armed again as soon as the
+// spindle is back at speed.
+func (o *TinygController) spindleMonitor() {
+	var setpoint float64
+	var direction spindle.TDirection
+	armed := false
+	for !o.exit {
+		time.Sleep(spindleMonitorInterval)
+		if o.Spindle == nil {
+			continue
+		}
+		rpm, dir := o.Spindle.Setpoint()
+		if rpm != setpoint || dir != direction {
+			setpoint, direction = rpm, dir
+			armed = false
+		}
+		if direction == spindle.DirectionStop || !o.JobRunning() {
+			armed = false
+			continue
+		}
+		if !armed {
+			armed = o.Spindle.AtSpeed()
+			continue
+		}
+		var msg string
+		if err := o.Spindle.Fault(); err != nil {
+			msg = "Spindle fault: " + err.Error()
+		} else if actual := o.Spindle.ActualRpm(); o.SpindleStallPercent > 0 && actual < setpoint*o.SpindleStallPercent/100 {
+			msg = fmt.Sprintf("Spindle stalled: %.0f of %.0f RPM", actual, setpoint)
+		} else {
+			continue
+		}
+		o.FeedHold()
+		o.recordAlarm(tgjson.StatusSpindleMustBeTurning, msg)
+		armed = false
+	}
+}
+
+// waitSpindleAtSpeed blocks until the spindle reports to be at speed.
+// On timeout a feed hold is sent and an alarm is recorded, so the
+// program does not continue cutting at a wrong speed. A flush aborts
+// the wait. Returns true if the spindle is at speed.
+func (o *TinygController) waitSpindleAtSpeed() bool {
+	deadline := time.Now().Add(o.SpindleAtSpeedTimeout)
+	for !o.Spindle.AtSpeed() {
+		if atomic.LoadInt32(&o.lineQueueEmptyFlag) != 0 {
+			return false
+		}
+		if time.Now().After(deadline) {
+			setpoint, _ := o.Spindle.Setpoint()
+			o.FeedHold()
+			o.recordAlarm(tgjson.StatusSpindleSpeedBelowMinimum, fmt.Sprintf(
+				"Spindle not at speed after %v: %.0f of %.0f RPM",
+				o.SpindleAtSpeedTimeout, o.Spindle.ActualRpm(), setpoint))
+			return false
+		}
+		time.Sleep(spindlePollInterval)
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpindleAtSpeed(t *testing.T) {
+	sim := spindle.NewSimulated(100000)
+	var atSpeed int32
+	tg, port := newTestController(t, func(line string) []string {
+		if line == "G0 X1" && sim.AtSpeed() {
+			atomic.StoreInt32(&atSpeed, 1)
+		}
+		return ackLines(line)
+	})
+	tg.Spindle = sim
+	tg.SpindleAtSpeedTimeout = time.Second
+	tg.queueJob([][]string{{"M3 S10000"}, {"G0 X1"}})
+	waitFor(t, "the program", func() bool { return len(port.Written()) == 2 })
+	if atomic.LoadInt32(&atSpeed) == 0 {
+		t.Error("Program continued before the spindle was at speed")
+	}
+
+	// A slow spindle holds the program and raises an alarm
+	tg, port = newTestController(t, ackLines)
+	tg.Spindle = spindle.NewSimulated(1000)
+	tg.SpindleAtSpeedTimeout = 100 * time.Millisecond
+	tg.queueJob([][]string{{"M3 S10000"}, {"G0 X1"}})
+	waitFor(t, "the program", func() bool { return len(port.Written()) == 3 })
+	if written := port.Written(); !reflect.DeepEqual(written, []string{"!", "M3 S10000", "G0 X1"}) {
+		t.Errorf("Written %q", written)
+	}
+	if alarms := tg.Alarms(0); len(alarms) != 1 || alarms[0].Status != tgjson.StatusSpindleSpeedBelowMinimum {
+		t.Error("Wrong alarms: ", alarms)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"github.com/golang/glog"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/spindle"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const motionEndTimeout time.Duration = 30 * time.Minute
+
+var (
+	ErrNoToolChangePending = errors.New("no tool change pending")
+	ErrToolChangeCancelled = errors.New("tool change cancelled")
+)
+
+// TToolChangeSettings configures the handling of M6 in programs.
+type TToolChangeSettings struct {
+	Enabled       bool           `json:"enabled"`       // intercept M6, otherwise it is sent to TinyG
+	Position      string         `json:"position"`      // saved position to change the tool at
+	SafeZ         float64        `json:"safeZ"`         // machine Z for moves between positions
+	ProbePosition string         `json:"probePosition"` // saved position above the tool length sensor, empty to skip probing
+	Probe         TProbeSettings `json:"probe"`
+}
+
+// TToolChangeState describes a tool change waiting for the operator.
+type TToolChangeState struct {
+	Pending bool      `json:"pending"`
+	Tool    int       `json:"tool"`
+	Since   time.Time `json:"since"`
+}
+
+// ToolChangeState returns the current tool change state.
+func (o *TinygController) ToolChangeState() TToolChangeState {
+	o.toolChangeLock.Lock()
+	defer o.toolChangeLock.Unlock()
+	return o.toolChange
+}
+
+// ConfirmToolChange continues a program after the operator has inserted the tool.
+func (o *TinygController) ConfirmToolChange() error {
+	return o.answerToolChange(true)
+}
+
+// CancelToolChange aborts a pending tool change and flushes the program.
+func (o *TinygController) CancelToolChange() error {
+	return o.answerToolChange(false)
+}
+
+func (o *TinygController) answerToolChange(confirmed bool) error {
+	o.toolChangeLock.Lock()
+	defer o.toolChangeLock.Unlock()
+	if !o.toolChange.Pending {
+		return ErrNoToolChangePending
+	}
+	select {
+	case o.toolChangeAnswer <- confirmed:
+	default: // already answered
+	}
+	return nil
+}
+
+// selectTool records the tool of a T word.
+func (o *TinygController) selectTool(tool int) {
+	o.toolChangeLock.Lock()
+	defer o.toolChangeLock.Unlock()
+	o.selectedTool = tool
+}
+
+// currentTool returns the tool of the last T word.
+func (o *TinygController) currentTool() int {
+	o.toolChangeLock.Lock()
+	defer o.toolChangeLock.Unlock()
+	return o.selectedTool
+}
+
+// interceptLine is called by the transmitter for every program line
+// before it is sent. It returns the line to send, which is empty if
+// the line has been handled completely.
+func (o *TinygController) interceptLine(cmd string) string {
+	if gcode.IsJson(cmd) {
+		return cmd
+	}
+	line := gcode.ParseLine(cmd)
+	if tool, ok := line.Value('T'); ok {
+		o.selectTool(int(tool))
+	}
+	if o.Tools != nil && (line.HasCode('G', 43) || line.HasCode('G', 49)) {
+		number := 0
+		if line.HasCode('G', 43) {
+			number = o.currentTool()
+			if h, ok := line.Value('H'); ok {
+				number = int(h)
+			}
+		}
+		o.waitForMotionEnd()
+		if err := o.applyToolLength(number); err != nil {
+			o.abortProgram("Tool length compensation failed: ", err)
+			return ""
+		}
+		// Compensation is done by the controller, not by TinyG
+		line = line.WithoutCode('G', 43).WithoutCode('G', 49).Without("H")
+		cmd = line.String()
+	}
+	if !line.HasCode('M', 6) || !o.ToolChange.Enabled {
+		return cmd
+	}
+	if err := o.runToolChange(o.currentTool()); err != nil {
+		if err != ErrToolChangeCancelled {
+			o.abortProgram("Tool change failed: ", err)
+		} else {
+			o.Flush()
+		}
+		return ""
+	}
+	// TinyG does not handle M6, send the remaining words only
+	return line.WithoutCode('M', 6).Without("TN").String()
+}
+
+// abortProgram flushes the running program and records an alarm.
+func (o *TinygController) abortProgram(msg string, err error) {
+	glog.Errorln(msg, err)
+	o.recordAlarm(tgjson.StatusGenericError, msg+err.Error())
+	o.Flush()
+}
+
+// waitForMotionEnd waits until TinyG has acknowledged and executed all
+// queued moves.
+func (o *TinygController) waitForMotionEnd() bool {
+	for atomic.LoadInt32(&o.linesToSend) < linesToSendDefault && atomic.LoadInt32(&o.lineQueueEmptyFlag) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(250 * time.Millisecond) // let the next status report show the motion
+	return o.waitForState(func(state tgjson.TMachineState) bool {
+		switch state {
+		case tgjson.StateRun, tgjson.StateCycle, tgjson.StateHold, tgjson.StateProbe, tgjson.StateHoming:
+			return false
+		}
+		return true
+	}, motionEndTimeout)
+}
+
+// runToolChange stops the spindle, moves to the tool change position and
+// waits for the operator. The tool length is probed afterwards if configured
+// and the Z offset of the active work coordinate system is corrected by
+// the difference to the previous tool.
+func (o *TinygController) runToolChange(tool int) (err error) {
+	glog.Infoln("Tool change to T", tool)
+	if !o.waitForMotionEnd() {
+		return ErrToolChangeCancelled
+	}
+	spindleState := o.spindleState
+	o.writeDirect("M5")
+	o.handleSpindleCommand("M5")
+	if len(o.ToolChange.Position) > 0 {
+		if err = o.moveToSavedPosition(o.ToolChange.Position, o.ToolChange.SafeZ); err != nil {
+			return
+		}
+		o.waitForMotionEnd()
+	}
+
+	o.toolChangeLock.Lock()
+	o.toolChangeAnswer = make(chan bool, 1)
+	o.toolChange = TToolChangeState{Pending: true, Tool: tool, Since: time.Now()}
+	answer := o.toolChangeAnswer
+	o.toolChangeLock.Unlock()
+	confirmed := <-answer
+	o.toolChangeLock.Lock()
+	o.toolChange = TToolChangeState{}
+	o.toolChangeLock.Unlock()
+	if !confirmed {
+		return ErrToolChangeCancelled
+	}
+
+	if len(o.ToolChange.ProbePosition) > 0 {
+		if err = o.probeToolLength(); err != nil {
+			return
+		}
+	} else if o.Tools != nil {
+		if _, ok := o.Tools.Get(tool); ok {
+			if err = o.applyToolLength(tool); err != nil {
+				return
+			}
+		}
+	}
+	if spindleState.Direction != spindle.DirectionStop {
+		o.handleSpindleCommand(spindleState.String())
+		o.writeDirect(spindleState.String())
+	}
+	return
+}
+
+// probeToolLength measures the tool on the length sensor and shifts the
+// Z offset of the active coordinate system by the difference to the last
+// measured tool. The first measurement only sets the reference.
+func (o *TinygController) probeToolLength() error {
+	if err := o.moveToSavedPosition(o.ToolChange.ProbePosition, o.ToolChange.SafeZ); err != nil {
+		return err
+	}
+	settings := o.ToolChange.Probe
+	pos, err := o.probe("Z", -1, settings.MaxDistance, settings.Feed)
+	if err != nil {
+		return err
+	}
+	o.writeDirect("G53 G0 Z" + gcode.FormatNumber(o.ToolChange.SafeZ))
+	if o.toolLengthKnown {
+		err = o.shiftWorkOffsetZ(pos.Z - o.toolLengthZ)
+	}
+	o.toolLengthZ = pos.Z
+	o.toolLengthKnown = err == nil
+	return err
+}
+
+// shiftWorkOffsetZ adds delta to the Z offset of the active work
+// coordinate system, e.g. to compensate a longer tool. The offset is
+// requested from TinyG first, the buffered one may be outdated.
+func (o *TinygController) shiftWorkOffsetZ(delta float64) error {
+	p, err := o.activeCoordinateSystem()
+	if err != nil {
+		return err
+	}
+	cs := tgjson.TCoordinateSystem(p)
+	if err = o.requestReports(strings.ToLower(cs.String())); err != nil {
+		return err
+	}
+	o.stateLock.RLock()
+	offset := *o.tinygState.ResponseData.WorkOffset(cs)
+	o.stateLock.RUnlock()
+	return o.setWorkOffset(cs, map[string]float64{"Z": offset.Z + delta})
+}
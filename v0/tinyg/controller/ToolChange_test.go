@@ -0,0 +1,79 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"reflect"
+	"testing"
+)
+
+// stoppedMachine answers every line and reports a stopped machine.
+func stoppedMachine(line string) []string {
+	if line == tgjson.CommandRequestStatus {
+		return []string{`{"r":{"sr":{"stat":3}},"f":[1,0,8]}`}
+	}
+	return ackLines(line)
+}
+
+// commands returns the written lines without status requests.
+func commands(written []string) (lines []string) {
+	for _, line := range written {
+		if line != tgjson.CommandRequestStatus {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+func newToolChangeController(t *testing.T) (*TinygController, *tFakePort) {
+	tg, port := newTestController(t, stoppedMachine)
+	setState(t, tg, `{"sr":{"stat":3}}`)
+	tg.Positions = &TSavedPositions{positions: map[string]tgjson.TOffset{"change": {X: 10, Y: 20, Z: -30}}}
+	tg.ToolChange = TToolChangeSettings{Enabled: true, Position: "change", SafeZ: -1}
+	tg.queueJob([][]string{{"M3 S10000"}, {"T2 M6"}, {"G0 X1"}})
+	waitFor(t, "the tool change", func() bool { return tg.ToolChangeState().Pending })
+	return tg, port
+}
+
+func TestToolChange(t *testing.T) {
+	tg, port := newToolChangeController(t)
+	if state := tg.ToolChangeState(); state.Tool != 2 {
+		t.Error("Wrong tool: ", state.Tool)
+	}
+	if err := tg.Jog("Z", 5, 100); err != nil {
+		t.Error("Jog refused during the tool change: ", err)
+	}
+	tg.ConfirmToolChange()
+	waitFor(t, "the program", func() bool { return len(commands(port.Written())) == 9 })
+	expected := []string{"M3 S10000", "M5", "G53 G0 Z-1.0000", "G53 G0 X10.0000 Y20.0000", "G53 G0 Z-30.0000",
+		"G91 G1 Z5.0000 F100.0", "G90", "M3 S10000", "G0 X1"}
+	if written := commands(port.Written()); !reflect.DeepEqual(written, expected) {
+		t.Errorf("Written %q", written)
+	}
+	if err := tg.ConfirmToolChange(); err != ErrNoToolChangePending {
+		t.Error("Confirmed twice: ", err)
+	}
+}
+
+func TestToolChangeCancelled(t *testing.T) {
+	tg, port := newToolChangeController(t)
+	tg.CancelToolChange()
+	waitFor(t, "the flush", func() bool { return !tg.JobRunning() })
+	if written := commands(port.Written()); written[len(written)-1] != "\x04" {
+		t.Errorf("Program continued after cancelling: %q", written)
+	}
+}
+
+func TestShiftWorkOffsetZ(t *testing.T) {
+	fake := &tFakeOffsets{active: tgjson.CoordinateSystemG56}
+	fake.offsets[tgjson.CoordinateSystemG56] = tgjson.TOffset{X: 1, Z: -40}
+	tg, port := newTestController(t, fake.respond)
+	setState(t, tg, `{"sr":{"coor":3}}`)
+	// The buffered offset is outdated, the shift starts at the one of TinyG
+	setState(t, tg, `{"r":{"g56":{"x":1,"y":0,"z":-10}},"f":[1,0,8]}`)
+	if err := tg.shiftWorkOffsetZ(2.5); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); written[0] != "{g56:n}" || fake.offsets[3].Z != -37.5 {
+		t.Errorf("Wrong shift %v: %q", fake.offsets[3], written)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrNoSuchTool        = errors.New("no such tool")
+	ErrInvalidToolNumber = errors.New("invalid tool number")
+	ErrNoToolTable       = errors.New("no tool table configured")
+)
+
+// TTool describes a tool of the tool table. LengthOffset is the
+// length of the tool relative to the reference tool, which was used for
+// setting the Z zero. Longer tools have positive offsets.
+type TTool struct {
+	Number       int     `json:"number"`
+	Description  string  `json:"description"`
+	Diameter     float64 `json:"diameter"`
+	LengthOffset float64 `json:"lengthOffset"`
+}
+
+// tToolTableFile is the storage format of a tool table.
+type tToolTableFile struct {
+	Tools []TTool `json:"tools"`
+	// Tool whose length offset is applied to the work offset
+	Active int `json:"active"`
+	// Length offset currently included in the work offset
+	AppliedLength float64 `json:"appliedLength"`
+}
+
+// TToolTable is a persisted tool table. As TinyG's tool length support
+// is limited, the controller applies the length offsets itself by
+// shifting the Z offset of the active work coordinate system. The
+// applied offset is stored together with the tools, because TinyG keeps
+// the work offsets over a restart.
+type TToolTable struct {
+	path          string
+	lock          sync.Mutex
+	tools         map[int]TTool
+	active        int
+	appliedLength float64
+}
+
+// LoadToolTable reads the tool table stored at path.
+// A missing file results in an empty table.
+func LoadToolTable(path string) (table *TToolTable, err error) {
+	table = &TToolTable{path: path, tools: make(map[int]TTool)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return table, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var file tToolTableFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, tool := range file.Tools {
+		table.tools[tool.Number] = tool
+	}
+	table.active = file.Active
+	table.appliedLength = file.AppliedLength
+	return
+}
+
+func (o *TToolTable) save() error {
+	file := tToolTableFile{Tools: o.list(), Active: o.active, AppliedLength: o.appliedLength}
+	data, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(o.path, data, 0644)
+}
+
+func (o *TToolTable) list() (tools []TTool) {
+	tools = make([]TTool, 0, len(o.tools))
+	for _, tool := range o.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Number < tools[j].Number })
+	return
+}
+
+// Tools returns all tools sorted by number.
+func (o *TToolTable) Tools() []TTool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.list()
+}
+
+// Get returns a tool of the table.
+func (o *TToolTable) Get(number int) (tool TTool, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	tool, ok = o.tools[number]
+	return
+}
+
+// Set stores a tool and persists the table.
+func (o *TToolTable) Set(tool TTool) error {
+	if tool.Number <= 0 {
+		return ErrInvalidToolNumber
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.tools[tool.Number] = tool
+	return o.save()
+}
+
+// Delete removes a tool and persists the table.
+func (o *TToolTable) Delete(number int) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if _, ok := o.tools[number]; !ok {
+		return ErrNoSuchTool
+	}
+	delete(o.tools, number)
+	return o.save()
+}
+
+// Active returns the selected tool and the length offset which is
+// included in the work offset.
+func (o *TToolTable) Active() (number int, appliedLength float64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.active, o.appliedLength
+}
+
+func (o *TToolTable) setActive(number int, appliedLength float64) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.active = number
+	o.appliedLength = appliedLength
+	return o.save()
+}
+
+// SelectTool makes a tool of the tool table the active one and applies
+// its length offset. Tool 0 removes the length compensation. The tool
+// has to be inserted already, use M6 in a program for a tool change.
+func (o *TinygController) SelectTool(number int) error {
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	return o.applyToolLength(number)
+}
+
+// applyToolLength shifts the Z offset of the active work coordinate
+// system by the difference between the length offset of the tool and
+// the currently applied length offset (G43 style compensation). The
+// shift starts at the offset read back from TinyG, not the buffered one.
+func (o *TinygController) applyToolLength(number int) error {
+	if o.Tools == nil {
+		return ErrNoToolTable
+	}
+	var length float64
+	if number != 0 {
+		tool, ok := o.Tools.Get(number)
+		if !ok {
+			return ErrNoSuchTool
+		}
+		length = tool.LengthOffset
+	}
+	_, applied := o.Tools.Active()
+	if length != applied {
+		glog.Infoln("Tool length compensation for T", number, ": ", length)
+		if err := o.shiftWorkOffsetZ(length - applied); err != nil {
+			return err
+		}
+	}
+	return o.Tools.setActive(number, length)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToolTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinyg-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tools.json")
+	table, err := LoadToolTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = table.Set(TTool{Number: 0}); err != ErrInvalidToolNumber {
+		t.Error("Tool 0 accepted: ", err)
+	}
+	table.Set(TTool{Number: 1, Diameter: 6, LengthOffset: 2})
+	table.Set(TTool{Number: 2, Diameter: 3, LengthOffset: -1.5})
+
+	fake := &tFakeOffsets{active: tgjson.CoordinateSystemG55}
+	fake.offsets[tgjson.CoordinateSystemG55] = tgjson.TOffset{Z: 5}
+	tg, _ := newTestController(t, fake.respond)
+	if err = tg.SelectTool(1); err != ErrNoToolTable {
+		t.Error("Tool selected without table: ", err)
+	}
+	tg.Tools = table
+	setState(t, tg, `{"sr":{"coor":2}}`)
+	// The buffered offset is outdated, TinyG's offset is shifted by the
+	// difference of the length offsets
+	setState(t, tg, `{"r":{"g55":{"x":0,"y":0,"z":-20}},"f":[1,0,8]}`)
+	expected := []struct {
+		tool    int
+		offsetZ float64
+	}{{1, 7}, {2, 3.5}, {0, 5}}
+	for _, e := range expected {
+		if err = tg.SelectTool(e.tool); err != nil {
+			t.Fatal(err)
+		}
+		if z := fake.offsets[tgjson.CoordinateSystemG55].Z; z != e.offsetZ {
+			t.Errorf("Z offset %v with T%d, expected %v", z, e.tool, e.offsetZ)
+		}
+	}
+	if err = tg.SelectTool(3); err != ErrNoSuchTool {
+		t.Error("Missing tool selected: ", err)
+	}
+
+	if table, err = LoadToolTable(path); err != nil {
+		t.Fatal(err)
+	}
+	if active, applied := table.Active(); active != 0 || applied != 0 || len(table.Tools()) != 2 {
+		t.Error("Wrong table after loading: ", table.Tools(), active, applied)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	offsetVerifyTimeout   time.Duration = 3 * time.Second
+	offsetVerifyTolerance float64       = 0.001
+)
+
+var (
+	ErrInvalidCoordinateSystem = errors.New("invalid work coordinate system, use G54 to G59")
+	ErrOffsetVerification      = errors.New("offset readback does not match")
+	ErrOffsetNotReported       = errors.New("offset not reported by TinyG")
+)
+
+// workOffsetKeys are the keys of the work offsets in TinyG's responses.
+var workOffsetKeys = []string{"g54", "g55", "g56", "g57", "g58", "g59", "g92"}
+
+// reportedOffsets returns the offsets and positions of a response by key,
+// nil if not contained.
+func reportedOffsets(data *tgjson.TReceiveObjects) map[string]*tgjson.TOffset {
+	return map[string]*tgjson.TOffset{
+		"mpo": data.AbsoluteMachinePosition,
+		"pos": data.WorkingPosition,
+		"g28": data.SavedPositionG28,
+		"g30": data.SavedPositionG30,
+		"g54": data.OffsetG54,
+		"g55": data.OffsetG55,
+		"g56": data.OffsetG56,
+		"g57": data.OffsetG57,
+		"g58": data.OffsetG58,
+		"g59": data.OffsetG59,
+		"g92": data.AddonOffsetG92,
+	}
+}
+
+// countReports counts the offsets and positions of a response, requires
+// stateLock. The buffered state holds zeros for values never reported.
+func (o *TinygController) countReports(data *tgjson.TReceiveObjects) {
+	if o.reports == nil {
+		o.reports = make(map[string]int)
+	}
+	for key, offset := range reportedOffsets(data) {
+		if offset != nil {
+			o.reports[key]++
+		}
+	}
+}
+
+// reportCount returns how often TinyG has reported an offset or position,
+// e.g. "g55" or "mpo".
+func (o *TinygController) reportCount(key string) int {
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
+	return o.reports[key]
+}
+
+// requestReports requests offsets or positions by key and waits until
+// TinyG has reported each of them.
+func (o *TinygController) requestReports(keys ...string) error {
+	before := make(map[string]int)
+	for _, key := range keys {
+		before[key] = o.reportCount(key)
+		o.writeDirect("{" + key + ":n}")
+	}
+	for _, key := range keys {
+		key := key
+		if !o.waitFor(func() bool { return o.reportCount(key) > before[key] }, "{"+key+":n}", offsetVerifyTimeout) {
+			return fmt.Errorf("%w: %s", ErrOffsetNotReported, key)
+		}
+	}
+	return nil
+}
+
+// WorkOffsets returns the offsets of G54 to G59 and G92 reported by TinyG,
+// keyed by name. Use RefreshOffsets to request all of them from TinyG.
+func (o *TinygController) WorkOffsets() (offsets map[string]tgjson.TOffset) {
+	o.stateLock.RLock()
+	defer o.stateLock.RUnlock()
+	offsets = make(map[string]tgjson.TOffset)
+	all := reportedOffsets(&o.tinygState.ResponseData)
+	for _, key := range workOffsetKeys {
+		if o.reports[key] > 0 {
+			offsets[strings.ToUpper(key)] = *all[key]
+		}
+	}
+	return
+}
+
+// RefreshOffsets requests the offsets of all work coordinate systems and
+// G92 and waits until TinyG has reported them.
+func (o *TinygController) RefreshOffsets() error {
+	return o.requestReports(workOffsetKeys...)
+}
+
+// SetWorkOffset sets the offsets of a work coordinate system (G10 L2), e.g.
+// SetWorkOffset(CoordinateSystemG55, map[string]float64{"x": 100, "z": -20}).
+// Axes which are not given keep their offset. The new offsets are read back
+// from TinyG and ErrOffsetVerification is returned if they do not match.
+func (o *TinygController) SetWorkOffset(cs tgjson.TCoordinateSystem, axes map[string]float64) (err error) {
+	if cs < tgjson.CoordinateSystemG54 || cs > tgjson.CoordinateSystemG59 {
+		return ErrInvalidCoordinateSystem
+	}
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	return o.setWorkOffset(cs, axes)
+}
+
+// setWorkOffset implements SetWorkOffset without checking for a running job.
+func (o *TinygController) setWorkOffset(cs tgjson.TCoordinateSystem, axes map[string]float64) (err error) {
+	words, expected, err := axisWords(axes)
+	if err != nil {
+		return
+	}
+	o.writeDirect(fmt.Sprintf("G10 L2 P%d %s", int(cs), words))
+	verified := o.waitFor(func() bool {
+		o.stateLock.RLock()
+		defer o.stateLock.RUnlock()
+		offset := o.tinygState.ResponseData.WorkOffset(cs)
+		return offset != nil && offsetMatches(*offset, expected)
+	}, tgjson.CommandRequestWorkOffset(cs), offsetVerifyTimeout)
+	if !verified {
+		return ErrOffsetVerification
+	}
+	return
+}
+
+// ZeroAxis sets the current position of an axis to zero in the active
+// work coordinate system (G10 L20) and verifies the new work position.
+func (o *TinygController) ZeroAxis(axis string) (err error) {
+	if axis, err = normalizeAxis(axis); err != nil {
+		return
+	}
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	p, err := o.activeCoordinateSystem()
+	if err != nil {
+		return ErrInvalidCoordinateSystem
+	}
+	o.writeDirect(fmt.Sprintf("G10 L20 P%d %s0", p, axis))
+	verified := o.waitFor(func() bool {
+		o.stateLock.RLock()
+		defer o.stateLock.RUnlock()
+		pos := o.tinygState.ResponseData.WorkingPosition
+		return pos != nil && math.Abs(offsetAxis(*pos, axis)) < offsetVerifyTolerance
+	}, tgjson.CommandRequestWorkingPosition, offsetVerifyTimeout)
+	if !verified {
+		return ErrOffsetVerification
+	}
+	o.write(tgjson.CommandRequestWorkOffset(tgjson.TCoordinateSystem(p)), false)
+	return
+}
+
+// SelectCoordinateSystem activates a work coordinate system (G54 to G59)
+// and waits until TinyG reports it as active.
+func (o *TinygController) SelectCoordinateSystem(cs tgjson.TCoordinateSystem) error {
+	if cs < tgjson.CoordinateSystemG54 || cs > tgjson.CoordinateSystemG59 {
+		return ErrInvalidCoordinateSystem
+	}
+	if o.JobRunning() {
+		return ErrJobRunning
+	}
+	o.writeDirect(cs.String())
+	verified := o.waitFor(func() bool {
+		sr := o.statusReport()
+		return sr.CoordinateSystem != nil && *sr.CoordinateSystem == cs
+	}, tgjson.CommandRequestStatus, offsetVerifyTimeout)
+	if !verified {
+		return ErrOffsetVerification
+	}
+	o.write(tgjson.CommandRequestWorkOffset(cs), false)
+	return nil
+}
+
+// axisWords formats axis values as G-code words, e.g. "X1.0000 Z2.0000".
+func axisWords(axes map[string]float64) (words string, normalized map[string]float64, err error) {
+	normalized = make(map[string]float64)
+	for axis, value := range axes {
+		var name string
+		if name, err = normalizeAxis(axis); err != nil || name == "A" {
+			return "", nil, ErrInvalidAxis
+		}
+		normalized[name] = value
+	}
+	if len(normalized) == 0 {
+		return "", nil, ErrInvalidAxis
+	}
+	list := make([]string, 0, len(normalized))
+	for axis, value := range normalized {
+		list = append(list, axis+gcode.FormatNumber(value))
+	}
+	sort.Strings(list)
+	return strings.Join(list, " "), normalized, nil
+}
+
+func offsetMatches(offset tgjson.TOffset, expected map[string]float64) bool {
+	for axis, value := range expected {
+		if math.Abs(offsetAxis(offset, axis)-value) > offsetVerifyTolerance {
+			return false
+		}
+	}
+	return true
+}
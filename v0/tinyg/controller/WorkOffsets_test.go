@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	tgjson "github.com/itschleemilch/tinyg-api/v0/tinyg/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var offsetWord = regexp.MustCompile(`([XYZ])(-?[0-9.]+)`)
+
+// tFakeOffsets simulates the work offsets of TinyG. G10 L2 and L20 change
+// the offsets, which can be requested together with G92 and the work position.
+type tFakeOffsets struct {
+	machine tgjson.TOffset
+	offsets [7]tgjson.TOffset
+	g92     tgjson.TOffset
+	active  tgjson.TCoordinateSystem
+}
+
+func (o *tFakeOffsets) respond(line string) []string {
+	var l, p int
+	if n, _ := fmt.Sscanf(line, "G10 L%d P%d", &l, &p); n == 2 {
+		for _, word := range offsetWord.FindAllStringSubmatch(line, -1) {
+			value, _ := strconv.ParseFloat(word[2], 64)
+			if l == 20 {
+				value = offsetAxis(o.machine, word[1]) - value
+			}
+			switch word[1] {
+			case "X":
+				o.offsets[p].X = value
+			case "Y":
+				o.offsets[p].Y = value
+			case "Z":
+				o.offsets[p].Z = value
+			}
+		}
+	}
+	answer := func(key string, offset tgjson.TOffset) []string {
+		data, _ := json.Marshal(map[string]interface{}{"r": map[string]tgjson.TOffset{key: offset}, "f": []int{1, 0, 8}})
+		return []string{string(data)}
+	}
+	for cs := tgjson.CoordinateSystemG54; cs <= tgjson.CoordinateSystemG59; cs++ {
+		if line == tgjson.CommandRequestWorkOffset(cs) {
+			return answer(strings.ToLower(cs.String()), o.offsets[cs])
+		}
+	}
+	if line == tgjson.CommandRequestG92Offset {
+		return answer("g92", o.g92)
+	}
+	if line == tgjson.CommandRequestWorkingPosition {
+		offset := o.offsets[o.active]
+		return answer("pos", tgjson.TOffset{X: o.machine.X - offset.X, Y: o.machine.Y - offset.Y, Z: o.machine.Z - offset.Z})
+	}
+	return ackLines(line)
+}
+
+func TestSetWorkOffset(t *testing.T) {
+	fake := &tFakeOffsets{active: tgjson.CoordinateSystemG55}
+	fake.offsets[tgjson.CoordinateSystemG55] = tgjson.TOffset{X: 1, Y: 3, Z: 5}
+	tg, port := newTestController(t, fake.respond)
+	if err := tg.SetWorkOffset(tgjson.CoordinateSystemG53, map[string]float64{"x": 1}); err != ErrInvalidCoordinateSystem {
+		t.Error("Offset of G53 accepted: ", err)
+	}
+	if err := tg.SetWorkOffset(tgjson.CoordinateSystemG55, map[string]float64{"a": 1}); err != ErrInvalidAxis {
+		t.Error("Offset of A accepted: ", err)
+	}
+	if err := tg.SetWorkOffset(tgjson.CoordinateSystemG55, map[string]float64{"x": 100, "Z": -20.5}); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); written[0] != "G10 L2 P2 X100.0000 Z-20.5000" {
+		t.Error("Wrong offset command: ", written[0])
+	}
+	if offsets := tg.WorkOffsets(); offsets["G55"] != (tgjson.TOffset{X: 100, Y: 3, Z: -20.5}) {
+		t.Error("Wrong offset read back: ", offsets["G55"])
+	}
+}
+
+func TestZeroAxis(t *testing.T) {
+	fake := &tFakeOffsets{machine: tgjson.TOffset{X: 10, Y: 20, Z: 30}, active: tgjson.CoordinateSystemG55}
+	tg, port := newTestController(t, fake.respond)
+	if err := tg.ZeroAxis("Y"); err != ErrInvalidCoordinateSystem {
+		t.Error("Zeroed without coordinate system: ", err)
+	}
+	setState(t, tg, `{"sr":{"coor":2}}`)
+	setState(t, tg, `{"r":{"pos":{"x":10,"y":20,"z":30}},"f":[1,0,8]}`)
+	if err := tg.ZeroAxis("y"); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); written[0] != "G10 L20 P2 Y0" || fake.offsets[2].Y != 20 {
+		t.Error("Wrong zeroing: ", written, fake.offsets[2])
+	}
+}
+
+func TestRefreshOffsets(t *testing.T) {
+	fake := &tFakeOffsets{g92: tgjson.TOffset{Z: -2}}
+	fake.offsets[tgjson.CoordinateSystemG57] = tgjson.TOffset{X: 4}
+	tg, port := newTestController(t, fake.respond)
+	if offsets := tg.WorkOffsets(); len(offsets) != 0 {
+		t.Error("Offsets known before they were reported: ", offsets)
+	}
+	if err := tg.RefreshOffsets(); err != nil {
+		t.Fatal(err)
+	}
+	if written := port.Written(); len(written) < 7 || written[6] != "{g92:n}" {
+		t.Error("Not all offsets requested: ", written)
+	}
+	offsets := tg.WorkOffsets()
+	if len(offsets) != 7 || offsets["G57"].X != 4 || offsets["G92"].Z != -2 {
+		t.Error("Wrong offsets: ", offsets)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package gcode
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strings"
+)
+
+// MillimetersPerInch converts inch programs to mm.
+const MillimetersPerInch float64 = 25.4
+
+// TAnalysis summarizes a program. Lengths are in program units (see Inch).
+type TAnalysis struct {
+	Lines    int        `json:"lines"`
+	Moves    int        `json:"moves"`
+	Inch     bool       `json:"inch"`
+	Min      [3]float64 `json:"min"`
+	Max      [3]float64 `json:"max"`
+	Bounded  [3]bool    `json:"bounded"` // false for axes without moves
+	Distance float64    `json:"distance"`
+	Seconds  float64    `json:"seconds"` // estimated run time without acceleration
+	Tools    []int      `json:"tools"`
+}
+
+// include extends the bounding box by the known axes of a position.
+func (o *TAnalysis) include(pos [3]float64, known [3]bool) {
+	for axis := range pos {
+		if !known[axis] {
+			continue
+		}
+		if !o.Bounded[axis] || pos[axis] < o.Min[axis] {
+			o.Min[axis] = pos[axis]
+		}
+		if !o.Bounded[axis] || pos[axis] > o.Max[axis] {
+			o.Max[axis] = pos[axis]
+		}
+		o.Bounded[axis] = true
+	}
+}
+
+// Analyze reads a program and returns its size, bounding box and estimated
+// run time. rapidFeed is the traverse rate in mm/min. Arcs are expected in
+// the XY plane (G17) with I and J offsets, R arcs are counted as lines.
+func Analyze(r io.Reader, rapidFeed float64) (analysis TAnalysis, err error) {
+	state := NewState()
+	tools := make(map[int]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		analysis.Lines++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || IsJson(text) {
+			continue
+		}
+		line := ParseLine(text)
+		if tool, ok := line.Value('T'); ok && !tools[int(tool)] {
+			tools[int(tool)] = true
+			analysis.Tools = append(analysis.Tools, int(tool))
+		}
+		start, startKnown := state.Position, state.Known
+		if !state.Apply(line) {
+			continue
+		}
+		analysis.Moves++
+		analysis.include(state.Position, state.Known)
+		if !knownMove(line, startKnown, state.Known) {
+			continue // distance unknown, e.g. first move after G28
+		}
+		distance := moveLength(state.Motion, start, state.Position, line, &analysis)
+		analysis.Distance += distance
+		if state.Motion == MotionTraverse {
+			if rapidFeed > 0 {
+				if state.Inch {
+					distance *= MillimetersPerInch
+				}
+				analysis.Seconds += distance / rapidFeed * 60
+			}
+		} else if state.Feed > 0 {
+			analysis.Seconds += distance / state.Feed * 60
+		}
+	}
+	analysis.Inch = state.Inch
+	return analysis, scanner.Err()
+}
+
+// knownMove returns true if all axes moved by a line have a known start
+// and end position. Axes which are not moved do not count.
+func knownMove(line TLine, startKnown, endKnown [3]bool) bool {
+	for axis := 0; axis < len(AxisLetters); axis++ {
+		if line.Has(AxisLetters[axis]) && (!startKnown[axis] || !endKnown[axis]) {
+			return false
+		}
+	}
+	return true
+}
+
+// moveLength returns the path length of a move. The bounding box is
+// extended by the extreme points of arcs.
+func moveLength(motion int, start, end [3]float64, line TLine, analysis *TAnalysis) float64 {
+	dz := end[AxisZ] - start[AxisZ]
+	i, hasI := line.Value('I')
+	j, hasJ := line.Value('J')
+	if (motion != MotionArcCw && motion != MotionArcCcw) || (!hasI && !hasJ) {
+		return math.Sqrt(math.Pow(end[AxisX]-start[AxisX], 2) + math.Pow(end[AxisY]-start[AxisY], 2) + dz*dz)
+	}
+	cx, cy := start[AxisX]+i, start[AxisY]+j
+	radius := math.Hypot(i, j)
+	a0, sweep := arcSweep(motion == MotionArcCw, cx, cy, start, end)
+	// Extreme points at 0, 90, 180 and 270 degrees within the sweep
+	for quadrant := 0; quadrant < 4; quadrant++ {
+		angle := float64(quadrant) * math.Pi / 2
+		offset := angle - a0
+		if motion == MotionArcCw {
+			offset = a0 - angle
+		}
+		offset = math.Mod(offset+4*math.Pi, 2*math.Pi)
+		if offset <= sweep {
+			point := [3]float64{cx + radius*math.Cos(angle), cy + radius*math.Sin(angle), 0}
+			analysis.include(point, [3]bool{true, true, false})
+		}
+	}
+	return math.Hypot(radius*sweep, dz)
+}
@@ -0,0 +1,29 @@
+package gcode
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	program := "G21 G90\nT2 M6\nG0 X0 Y0 Z5\nG1 Z-1 F60\nG1 X10 F600\n(half circle up to Y10)\nG3 X10 Y10 I0 J5\n\nG0 Z5\n"
+	analysis, err := Analyze(strings.NewReader(program), 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Lines != 9 || analysis.Moves != 5 || len(analysis.Tools) != 1 || analysis.Tools[0] != 2 {
+		t.Error("Wrong counts: ", analysis)
+	}
+	if analysis.Min != [3]float64{0, 0, -1} || math.Abs(analysis.Max[0]-15) > 1e-9 || analysis.Max[1] != 10 || analysis.Max[2] != 5 {
+		t.Error("Wrong bounding box: ", analysis.Min, analysis.Max)
+	}
+	arc := 5 * math.Pi
+	if math.Abs(analysis.Distance-(6+10+arc+6)) > 1e-9 {
+		t.Error("Wrong distance: ", analysis.Distance)
+	}
+	// plunge 6mm at 60, 10mm + arc at 600, retract 6mm rapid at 600
+	if seconds := 6.0 + (10+arc)/10 + 0.6; math.Abs(analysis.Seconds-seconds) > 1e-9 {
+		t.Error("Wrong time: ", analysis.Seconds, " instead of ", seconds)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package gcode
+
+import "math"
+
+// arcSweep returns the angle of the start point around the center and the
+// swept angle in radians, which is positive for both directions. An arc
+// ending at its start is a full circle.
+func arcSweep(clockwise bool, cx, cy float64, start, end [3]float64) (a0, sweep float64) {
+	a0 = math.Atan2(start[AxisY]-cy, start[AxisX]-cx)
+	a1 := math.Atan2(end[AxisY]-cy, end[AxisX]-cx)
+	sweep = a1 - a0
+	if clockwise {
+		sweep = a0 - a1
+	}
+	for sweep <= 1e-9 {
+		sweep += 2 * math.Pi
+	}
+	return
+}
+
+// ArcCenter returns the center of an arc in the XY plane from the I and J
+// offsets or the R word of line. A negative R selects the arc above 180
+// degrees.
+func ArcCenter(clockwise bool, start, end [3]float64, line TLine) (cx, cy float64, ok bool) {
+	i, hasI := line.Value('I')
+	j, hasJ := line.Value('J')
+	if hasI || hasJ {
+		return start[AxisX] + i, start[AxisY] + j, true
+	}
+	r, hasR := line.Value('R')
+	dx, dy := end[AxisX]-start[AxisX], end[AxisY]-start[AxisY]
+	chord := math.Hypot(dx, dy)
+	if !hasR || chord == 0 || chord > 2*math.Abs(r)+1e-9 {
+		return 0, 0, false
+	}
+	h := math.Sqrt(math.Max(r*r-chord*chord/4, 0))
+	side := 1.0 // the center is right of the chord for clockwise arcs
+	if !clockwise {
+		side = -side
+	}
+	if r < 0 {
+		side = -side
+	}
+	cx = start[AxisX] + dx/2 + side*h*dy/chord
+	cy = start[AxisY] + dy/2 - side*h*dx/chord
+	return cx, cy, true
+}
+
+// SplitArc returns points along an arc in the XY plane with a distance of at
+// most segmentLength, the last point is the end point. Z changes linearly
+// for helical arcs. ok is false if the arc has no valid center.
+func SplitArc(clockwise bool, start, end [3]float64, line TLine, segmentLength float64) (points [][3]float64, ok bool) {
+	cx, cy, ok := ArcCenter(clockwise, start, end, line)
+	if !ok {
+		return nil, false
+	}
+	radius := math.Hypot(start[AxisX]-cx, start[AxisY]-cy)
+	a0, sweep := arcSweep(clockwise, cx, cy, start, end)
+	segments := int(math.Ceil(radius * sweep / segmentLength))
+	if segments < 1 {
+		segments = 1
+	}
+	for n := 1; n < segments; n++ {
+		f := float64(n) / float64(segments)
+		angle := a0 + sweep*f
+		if clockwise {
+			angle = a0 - sweep*f
+		}
+		points = append(points, [3]float64{
+			cx + radius*math.Cos(angle),
+			cy + radius*math.Sin(angle),
+			start[AxisZ] + (end[AxisZ]-start[AxisZ])*f,
+		})
+	}
+	return append(points, end), true
+}
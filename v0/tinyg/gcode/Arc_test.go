@@ -0,0 +1,30 @@
+package gcode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestArcCenter(t *testing.T) {
+	start, end := [3]float64{0, 0, 0}, [3]float64{10, 0, 0}
+	cases := []struct {
+		clockwise bool
+		line      string
+		cx, cy    float64
+	}{
+		{true, "G2 X10 Y0 I5 J0", 5, 0},
+		{true, "G2 X10 Y0 R5", 5, 0},
+		{true, "G2 X10 Y0 R10", 5, -8.6603}, // small clockwise arc bulges up
+		{true, "G2 X10 Y0 R-10", 5, 8.6603},
+		{false, "G3 X10 Y0 R10", 5, 8.6603},
+	}
+	for _, c := range cases {
+		cx, cy, ok := ArcCenter(c.clockwise, start, end, ParseLine(c.line))
+		if !ok || math.Abs(cx-c.cx) > 1e-4 || math.Abs(cy-c.cy) > 1e-4 {
+			t.Error(c.line, ": ", cx, cy, ok)
+		}
+	}
+	if _, _, ok := ArcCenter(true, start, end, ParseLine("G2 X10 Y0 R4")); ok {
+		t.Error("Radius below half the chord accepted")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package gcode
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TWord is a single letter/number pair like "G1" or "X10.5".
+type TWord struct {
+	Letter byte
+	Value  float64
+}
+
+func (o TWord) String() string {
+	return string(o.Letter) + strconv.FormatFloat(o.Value, 'f', -1, 64)
+}
+
+// Is compares letter and value of the word, e.g. Is('G', 38.2).
+func (o TWord) Is(letter byte, value float64) bool {
+	return o.Letter == letter && math.Abs(o.Value-value) < 0.0001
+}
+
+// TLine is a parsed G-code line without comments.
+type TLine struct {
+	Words []TWord
+}
+
+// StripComments removes (...) and ; comments from a line.
+func StripComments(line string) string {
+	var out strings.Builder
+	depth := 0
+	for _, c := range line {
+		switch {
+		case c == ';' && depth == 0:
+			return out.String()
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			out.WriteRune(c)
+		}
+	}
+	return out.String()
+}
+
+// IsJson returns true for TinyG JSON commands like {sr:n},
+// which must not be interpreted as G-code.
+func IsJson(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "{")
+}
+
+// ParseLine splits a line into words. Comments are ignored, as well as
+// characters which are not part of a valid word.
+func ParseLine(line string) (parsed TLine) {
+	line = strings.ToUpper(StripComments(line))
+	for n := 0; n < len(line); {
+		letter := line[n]
+		n++
+		if letter < 'A' || letter > 'Z' {
+			continue
+		}
+		for n < len(line) && line[n] == ' ' {
+			n++
+		}
+		start := n
+		for n < len(line) && (line[n] == '.' || line[n] == '-' || line[n] == '+' || (line[n] >= '0' && line[n] <= '9')) {
+			n++
+		}
+		value, err := strconv.ParseFloat(line[start:n], 64)
+		if err != nil {
+			continue
+		}
+		parsed.Words = append(parsed.Words, TWord{Letter: letter, Value: value})
+	}
+	return
+}
+
+// Value returns the value of the first word with the given letter.
+func (o TLine) Value(letter byte) (value float64, ok bool) {
+	for _, word := range o.Words {
+		if word.Letter == letter {
+			return word.Value, true
+		}
+	}
+	return
+}
+
+// Has returns true if the line contains a word with the given letter.
+func (o TLine) Has(letter byte) bool {
+	_, ok := o.Value(letter)
+	return ok
+}
+
+// HasCode returns true if the line contains the code, e.g. HasCode('M', 6).
+func (o TLine) HasCode(letter byte, value float64) bool {
+	for _, word := range o.Words {
+		if word.Is(letter, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAxis returns true if the line contains any X, Y or Z word.
+func (o TLine) HasAxis() bool {
+	return o.Has('X') || o.Has('Y') || o.Has('Z')
+}
+
+// Without returns a copy of the line without the words of the given letters.
+func (o TLine) Without(letters string) (out TLine) {
+	for _, word := range o.Words {
+		if strings.IndexByte(letters, word.Letter) < 0 {
+			out.Words = append(out.Words, word)
+		}
+	}
+	return
+}
+
+// WithoutCode returns a copy of the line without the given code, e.g. M6.
+func (o TLine) WithoutCode(letter byte, value float64) (out TLine) {
+	for _, word := range o.Words {
+		if !word.Is(letter, value) {
+			out.Words = append(out.Words, word)
+		}
+	}
+	return
+}
+
+func (o TLine) String() string {
+	words := make([]string, len(o.Words))
+	for n, word := range o.Words {
+		words[n] = word.String()
+	}
+	return strings.Join(words, " ")
+}
+
+// FormatNumber formats a coordinate with 4 decimals as sent to TinyG.
+func FormatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
@@ -0,0 +1,38 @@
+package gcode
+
+import "testing"
+
+func TestParseLine(t *testing.T) {
+	line := ParseLine("n10 g1 x10.5 Y-2 (comment Z3) f500 ; Z4")
+	if line.String() != "N10 G1 X10.5 Y-2 F500" {
+		t.Error("Wrong parse result: ", line.String())
+	}
+	if !line.HasCode('G', 1) || line.HasCode('G', 0) || line.Has('Z') {
+		t.Error("Wrong words detected")
+	}
+	if value, _ := line.Value('Y'); value != -2 {
+		t.Error("Y != -2")
+	}
+	if !ParseLine("G38.2 Z-10").HasCode('G', 38.2) {
+		t.Error("G38.2 not detected")
+	}
+	if rest := ParseLine("G43 H2 M6 T2 M8").WithoutCode('M', 6).WithoutCode('G', 43); rest.String() != "H2 T2 M8" {
+		t.Error("Wrong code removed: ", rest.String())
+	}
+}
+
+func TestStateApply(t *testing.T) {
+	state := NewState()
+	if state.Apply(ParseLine("X10")) {
+		t.Error("Move without motion mode detected")
+	}
+	if !state.Apply(ParseLine("G0 X1 Y2 Z3")) || state.Position != [3]float64{1, 2, 3} {
+		t.Error("Absolute move not tracked: ", state.Position)
+	}
+	if !state.Apply(ParseLine("G91 X1")) || state.Position[AxisX] != 2 {
+		t.Error("Incremental move not tracked: ", state.Position)
+	}
+	if state.Apply(ParseLine("G53 G0 Z0")) || state.Known[AxisZ] {
+		t.Error("G53 move has to invalidate the position")
+	}
+}
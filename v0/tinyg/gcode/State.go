@@ -0,0 +1,103 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package gcode
+
+const (
+	AxisX int = 0
+	AxisY int = 1
+	AxisZ int = 2
+)
+
+// AxisLetters contains the letters of the tracked axes in index order.
+const AxisLetters string = "XYZ"
+
+const (
+	MotionUnknown  int = -1
+	MotionTraverse int = 0
+	MotionStraight int = 1
+	MotionArcCw    int = 2
+	MotionArcCcw   int = 3
+)
+
+const (
+	PlaneXY int = 17
+	PlaneXZ int = 18
+	PlaneYZ int = 19
+)
+
+// TState tracks the modal state which is required to interpret moves.
+// Positions are program coordinates as written in the G-code.
+type TState struct {
+	Position    [3]float64
+	Known       [3]bool
+	Motion      int
+	Incremental bool
+	Inch        bool
+	Plane       int // arc plane, G17 to G19
+	Feed        float64
+}
+
+// NewState returns a state with unknown position and motion mode.
+func NewState() *TState {
+	return &TState{Motion: MotionUnknown, Plane: PlaneXY}
+}
+
+// Apply updates the state with a line. It returns true if the line
+// is a G0 to G3 move in the program coordinate system.
+func (o *TState) Apply(line TLine) (move bool) {
+	positionLost := false
+	for _, word := range line.Words {
+		switch {
+		case word.Letter == 'F':
+			o.Feed = word.Value
+		case word.Is('G', 0), word.Is('G', 1), word.Is('G', 2), word.Is('G', 3):
+			o.Motion = int(word.Value)
+		case word.Is('G', 90):
+			o.Incremental = false
+		case word.Is('G', 91):
+			o.Incremental = true
+		case word.Is('G', 20):
+			o.Inch = true
+		case word.Is('G', 21):
+			o.Inch = false
+		case word.Is('G', 17), word.Is('G', 18), word.Is('G', 19):
+			o.Plane = int(word.Value)
+		case word.Letter == 'G' && (word.Value == 10 || word.Value == 53 || word.Value == 92 ||
+			int(word.Value) == 28 || int(word.Value) == 30 || int(word.Value) == 38):
+			positionLost = true // G10, G53, G92, G28.x, G30, G38.x: axis words are no program moves
+		}
+	}
+	if !line.HasAxis() {
+		return false
+	}
+	for axis := 0; axis < len(AxisLetters); axis++ {
+		value, ok := line.Value(AxisLetters[axis])
+		if !ok {
+			continue
+		}
+		switch {
+		case positionLost:
+			o.Known[axis] = false
+		case o.Incremental:
+			o.Position[axis] += value
+		default:
+			o.Position[axis] = value
+			o.Known[axis] = true
+		}
+	}
+	return !positionLost && o.Motion != MotionUnknown
+}
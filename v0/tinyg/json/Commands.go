@@ -16,6 +16,8 @@
 
 package json
 
+import "strconv"
+
 const (
 	CommandEmptyLine                      string = ""
 	CommandRequestMachineAbsolutePosition string = "{mpo:n}"
@@ -43,5 +45,40 @@ const (
 	CommandQueueFlush                     string = "%"
 	CommandFeedHoldQueueFlush             string = "!%"
 	CommandSetFlowControlCts              string = "{ex:2}"
+	CommandClearAlarm                     string = "{clr:n}"
+	CommandRequestFeedOverride            string = "{mfo:n}"
+	CommandRequestTraverseOverride        string = "{mto:n}"
 	CommandHardwareReset                  string = "\x18"
 )
+
+// CommandSetFeedOverride returns the command setting the manual feed
+// rate override factor, e.g. 1.2 for 120%.
+func CommandSetFeedOverride(factor float64) string {
+	return "{mfo:" + strconv.FormatFloat(factor, 'f', 3, 64) + "}"
+}
+
+// CommandSetTraverseOverride returns the command setting the manual
+// traverse (G0) override factor.
+func CommandSetTraverseOverride(factor float64) string {
+	return "{mto:" + strconv.FormatFloat(factor, 'f', 3, 64) + "}"
+}
+
+// CommandRequestWorkOffset returns the command requesting the offset of
+// a work coordinate system (G54 to G59), or an empty command for G53.
+func CommandRequestWorkOffset(cs TCoordinateSystem) string {
+	switch cs {
+	case CoordinateSystemG54:
+		return CommandRequestG54Offset
+	case CoordinateSystemG55:
+		return CommandRequestG55Offset
+	case CoordinateSystemG56:
+		return CommandRequestG56Offset
+	case CoordinateSystemG57:
+		return CommandRequestG57Offset
+	case CoordinateSystemG58:
+		return CommandRequestG58Offset
+	case CoordinateSystemG59:
+		return CommandRequestG59Offset
+	}
+	return CommandEmptyLine
+}
@@ -27,3 +27,46 @@ const (
 	CoordinateSystemG58 TCoordinateSystem = 5
 	CoordinateSystemG59 TCoordinateSystem = 6
 )
+
+var coordinateSystemNames = enumNames{
+	int(CoordinateSystemG53): "G53",
+	int(CoordinateSystemG54): "G54",
+	int(CoordinateSystemG55): "G55",
+	int(CoordinateSystemG56): "G56",
+	int(CoordinateSystemG57): "G57",
+	int(CoordinateSystemG58): "G58",
+	int(CoordinateSystemG59): "G59",
+}
+
+// String returns the symbolic name of the value.
+func (o TCoordinateSystem) String() string {
+	return coordinateSystemNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TCoordinateSystem) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TCoordinateSystem) UnmarshalText(text []byte) error {
+	value, err := coordinateSystemNames.parse(string(text))
+	if err == nil {
+		*o = TCoordinateSystem(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TCoordinateSystem) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TCoordinateSystem) UnmarshalJSON(data []byte) error {
+	value, err := coordinateSystemNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TCoordinateSystem(value)
+	}
+	return err
+}
@@ -22,3 +22,41 @@ const (
 	DistanceAbsolute    TDistanceMode = 0
 	DistanceIncremental TDistanceMode = 1
 )
+
+var distanceModeNames = enumNames{
+	int(DistanceAbsolute):    "G90",
+	int(DistanceIncremental): "G91",
+}
+
+// String returns the symbolic name of the value.
+func (o TDistanceMode) String() string {
+	return distanceModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TDistanceMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TDistanceMode) UnmarshalText(text []byte) error {
+	value, err := distanceModeNames.parse(string(text))
+	if err == nil {
+		*o = TDistanceMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TDistanceMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TDistanceMode) UnmarshalJSON(data []byte) error {
+	value, err := distanceModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TDistanceMode(value)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package json
+
+import (
+	jsjson "encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// enumNames maps the numeric values of an enumeration to symbolic names.
+type enumNames map[int]string
+
+func (names enumNames) name(value int) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return strconv.Itoa(value)
+}
+
+func (names enumNames) parse(text string) (int, error) {
+	for value, name := range names {
+		if strings.EqualFold(name, text) {
+			return value, nil
+		}
+	}
+	if value, err := strconv.Atoi(text); err == nil {
+		return value, nil
+	}
+	return 0, fmt.Errorf("json: unknown name %q", text)
+}
+
+func (names enumNames) unmarshalJSON(data []byte) (int, error) {
+	var value int
+	if err := jsjson.Unmarshal(data, &value); err == nil {
+		return value, nil
+	}
+	var name string
+	if err := jsjson.Unmarshal(data, &name); err != nil {
+		return 0, err
+	}
+	return names.parse(name)
+}
+
+func marshalEnumJSON(value int) ([]byte, error) {
+	return []byte(strconv.Itoa(value)), nil
+}
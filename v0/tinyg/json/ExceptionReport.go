@@ -0,0 +1,35 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package json
+
+// TExceptionReport is sent asynchronously by TinyG on alarms, shutdowns,
+// limit switch hits and other errors, e.g.
+// {"er":{"fb":440.20,"st":204,"msg":"Limit switch hit - Shutdown occurred"}}
+type TExceptionReport struct {
+	FirmwareBuild float64             `json:"fb"`
+	Status        TResponseStatusCode `json:"st"`
+	Message       string              `json:"msg"`
+}
+
+// Description returns the message sent by TinyG or, if it is missing,
+// the message belonging to the status code.
+func (o *TExceptionReport) Description() string {
+	if len(o.Message) > 0 {
+		return o.Message
+	}
+	return o.Status.Message()
+}
@@ -22,3 +22,41 @@ const (
 	FeedRateUnitsPerMinute TFeedRateMode = 0
 	FeedRateInverseTime    TFeedRateMode = 1
 )
+
+var feedRateModeNames = enumNames{
+	int(FeedRateUnitsPerMinute): "G94",
+	int(FeedRateInverseTime):    "G93",
+}
+
+// String returns the symbolic name of the value.
+func (o TFeedRateMode) String() string {
+	return feedRateModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TFeedRateMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TFeedRateMode) UnmarshalText(text []byte) error {
+	value, err := feedRateModeNames.parse(string(text))
+	if err == nil {
+		*o = TFeedRateMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TFeedRateMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TFeedRateMode) UnmarshalJSON(data []byte) error {
+	value, err := feedRateModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TFeedRateMode(value)
+	}
+	return err
+}
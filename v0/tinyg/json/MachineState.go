@@ -19,13 +19,62 @@ package json
 type TMachineState int
 
 const (
-	StateReset TMachineState = 1
-	StateAlarm TMachineState = 2
-	StateStop  TMachineState = 3
-	StateEnd   TMachineState = 4
-	StateRun   TMachineState = 5
-	StateHold  TMachineState = 6
-	StateProbe TMachineState = 7
-	/* state 9 unused */
-	StateHoming TMachineState = 9
+	StateInitializing TMachineState = 0
+	StateReset        TMachineState = 1
+	StateAlarm        TMachineState = 2
+	StateStop         TMachineState = 3
+	StateEnd          TMachineState = 4
+	StateRun          TMachineState = 5
+	StateHold         TMachineState = 6
+	StateProbe        TMachineState = 7
+	StateCycle        TMachineState = 8
+	StateHoming       TMachineState = 9
+	StateJog          TMachineState = 10
 )
+
+var machineStateNames = enumNames{
+	int(StateInitializing): "initializing",
+	int(StateReset):        "ready",
+	int(StateAlarm):        "alarm",
+	int(StateStop):         "stop",
+	int(StateEnd):          "end",
+	int(StateRun):          "run",
+	int(StateHold):         "hold",
+	int(StateProbe):        "probe",
+	int(StateCycle):        "cycle",
+	int(StateHoming):       "homing",
+	int(StateJog):          "jog",
+}
+
+// String returns the symbolic name of the value.
+func (o TMachineState) String() string {
+	return machineStateNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TMachineState) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TMachineState) UnmarshalText(text []byte) error {
+	value, err := machineStateNames.parse(string(text))
+	if err == nil {
+		*o = TMachineState(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TMachineState) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TMachineState) UnmarshalJSON(data []byte) error {
+	value, err := machineStateNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TMachineState(value)
+	}
+	return err
+}
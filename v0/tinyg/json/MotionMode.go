@@ -24,3 +24,43 @@ const (
 	MotionModeArcCw    TMotionMode = 2
 	MotionModeArcCcw   TMotionMode = 3
 )
+
+var motionModeNames = enumNames{
+	int(MotionModeTraverse): "G0",
+	int(MotionModeStraight): "G1",
+	int(MotionModeArcCw):    "G2",
+	int(MotionModeArcCcw):   "G3",
+}
+
+// String returns the symbolic name of the value.
+func (o TMotionMode) String() string {
+	return motionModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TMotionMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TMotionMode) UnmarshalText(text []byte) error {
+	value, err := motionModeNames.parse(string(text))
+	if err == nil {
+		*o = TMotionMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TMotionMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TMotionMode) UnmarshalJSON(data []byte) error {
+	value, err := motionModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TMotionMode(value)
+	}
+	return err
+}
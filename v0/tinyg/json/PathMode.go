@@ -23,3 +23,42 @@ const (
 	PathExactPath TPathMode = 1
 	PathContinous TPathMode = 2
 )
+
+var pathModeNames = enumNames{
+	int(PathExactStop): "G61.1",
+	int(PathExactPath): "G61",
+	int(PathContinous): "G64",
+}
+
+// String returns the symbolic name of the value.
+func (o TPathMode) String() string {
+	return pathModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TPathMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TPathMode) UnmarshalText(text []byte) error {
+	value, err := pathModeNames.parse(string(text))
+	if err == nil {
+		*o = TPathMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TPathMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TPathMode) UnmarshalJSON(data []byte) error {
+	value, err := pathModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TPathMode(value)
+	}
+	return err
+}
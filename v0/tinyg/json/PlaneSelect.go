@@ -23,3 +23,42 @@ const (
 	PlaneXZ TPlaneSelect = 1
 	PlaneYZ TPlaneSelect = 2
 )
+
+var planeSelectNames = enumNames{
+	int(PlaneXY): "G17",
+	int(PlaneXZ): "G18",
+	int(PlaneYZ): "G19",
+}
+
+// String returns the symbolic name of the value.
+func (o TPlaneSelect) String() string {
+	return planeSelectNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TPlaneSelect) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TPlaneSelect) UnmarshalText(text []byte) error {
+	value, err := planeSelectNames.parse(string(text))
+	if err == nil {
+		*o = TPlaneSelect(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TPlaneSelect) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TPlaneSelect) UnmarshalJSON(data []byte) error {
+	value, err := planeSelectNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TPlaneSelect(value)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package json
+
+// TProbeReport is sent by TinyG at the end of a G38.2 probing cycle, e.g.
+// {"prb":{"e":1,"x":10.000,"y":20.000,"z":-3.124}}. The position is given
+// in absolute machine coordinates and is the point where the probe has
+// triggered, or the end point of the move if it has not.
+type TProbeReport struct {
+	Succeeded int `json:"e"`
+	TOffset
+}
+
+// Ok returns true if the probe has triggered.
+func (o *TProbeReport) Ok() bool {
+	return o.Succeeded == 1
+}
@@ -25,25 +25,29 @@ import (
 // from tinyg responses. They are all nullable (pointers) since
 // only one item is returned per request.
 type TReceiveObjects struct {
-	FirmwareVersion         *float64       `json:"fv"`
-	HardwarePlatform        *int           `json:"hp"`
-	HardwareVersion         *int           `json:"hv"`
-	StatusReport            *TStatusReport `json:"sr"`
-	ExceptionReport         *int           `json:"ex"`
-	QueueReport             *int           `json:"qr"`
-	RxBufferReport          *int           `json:"rx"`
-	AbsoluteMachinePosition *TOffset       `json:"mpo"`
-	WorkingPosition         *TOffset       `json:"pos"`
-	SavedPositionG28        *TOffset       `json:"g28"`
-	SavedPositionG30        *TOffset       `json:"g30"`
-	OffsetG54               *TOffset       `json:"g54"`
-	OffsetG55               *TOffset       `json:"g55"`
-	OffsetG56               *TOffset       `json:"g56"`
-	OffsetG57               *TOffset       `json:"g57"`
-	OffsetG58               *TOffset       `json:"g58"`
-	OffsetG59               *TOffset       `json:"g59"`
-	AddonOffsetG92          *TOffset       `json:"g92"`
-	RxMode                  *TRxMode       `json:"rxm"`
+	FirmwareVersion         *float64          `json:"fv"`
+	HardwarePlatform        *int              `json:"hp"`
+	HardwareVersion         *int              `json:"hv"`
+	StatusReport            *TStatusReport    `json:"sr"`
+	FlowControl             *int              `json:"ex"`
+	ExceptionReport         *TExceptionReport `json:"er"`
+	QueueReport             *int              `json:"qr"`
+	RxBufferReport          *int              `json:"rx"`
+	AbsoluteMachinePosition *TOffset          `json:"mpo"`
+	WorkingPosition         *TOffset          `json:"pos"`
+	SavedPositionG28        *TOffset          `json:"g28"`
+	SavedPositionG30        *TOffset          `json:"g30"`
+	OffsetG54               *TOffset          `json:"g54"`
+	OffsetG55               *TOffset          `json:"g55"`
+	OffsetG56               *TOffset          `json:"g56"`
+	OffsetG57               *TOffset          `json:"g57"`
+	OffsetG58               *TOffset          `json:"g58"`
+	OffsetG59               *TOffset          `json:"g59"`
+	AddonOffsetG92          *TOffset          `json:"g92"`
+	RxMode                  *TRxMode          `json:"rxm"`
+	ProbeReport             *TProbeReport     `json:"prb"`
+	FeedOverride            *float64          `json:"mfo"`
+	TraverseOverride        *float64          `json:"mto"`
 }
 
 func (dst *TReceiveObjects) UpdateFrom(src *TReceiveObjects) {
@@ -57,6 +61,9 @@ func (dst *TReceiveObjects) UpdateFrom(src *TReceiveObjects) {
 		dst.StatusReport = &TStatusReport{}
 	}
 	dst.StatusReport.UpdateFrom(src.StatusReport)
+	if src.FlowControl != nil {
+		dst.FlowControl = src.FlowControl
+	}
 	if src.ExceptionReport != nil {
 		dst.ExceptionReport = src.ExceptionReport
 	}
@@ -96,6 +103,9 @@ func (dst *TReceiveObjects) UpdateFrom(src *TReceiveObjects) {
 	if dst.OffsetG59 == nil {
 		dst.OffsetG59 = &TOffset{}
 	}
+	if dst.AddonOffsetG92 == nil {
+		dst.AddonOffsetG92 = &TOffset{}
+	}
 
 	dst.AbsoluteMachinePosition.UpdateFrom(src.AbsoluteMachinePosition)
 	dst.WorkingPosition.UpdateFrom(src.WorkingPosition)
@@ -107,17 +117,49 @@ func (dst *TReceiveObjects) UpdateFrom(src *TReceiveObjects) {
 	dst.OffsetG57.UpdateFrom(src.OffsetG57)
 	dst.OffsetG58.UpdateFrom(src.OffsetG58)
 	dst.OffsetG59.UpdateFrom(src.OffsetG59)
+	dst.AddonOffsetG92.UpdateFrom(src.AddonOffsetG92)
 	if src.RxMode != nil {
 		dst.RxMode = src.RxMode
 	}
+	if src.ProbeReport != nil {
+		dst.ProbeReport = src.ProbeReport
+	}
+	if src.FeedOverride != nil {
+		dst.FeedOverride = src.FeedOverride
+	}
+	if src.TraverseOverride != nil {
+		dst.TraverseOverride = src.TraverseOverride
+	}
+}
+
+// WorkOffset returns the stored offset of a work coordinate system
+// (G54 to G59) or nil for G53 and unknown values.
+func (o *TReceiveObjects) WorkOffset(cs TCoordinateSystem) *TOffset {
+	switch cs {
+	case CoordinateSystemG54:
+		return o.OffsetG54
+	case CoordinateSystemG55:
+		return o.OffsetG55
+	case CoordinateSystemG56:
+		return o.OffsetG56
+	case CoordinateSystemG57:
+		return o.OffsetG57
+	case CoordinateSystemG58:
+		return o.OffsetG58
+	case CoordinateSystemG59:
+		return o.OffsetG59
+	}
+	return nil
 }
 
 // TResponse is the central struct. It is used to store
 // data received from tinyg after sending a request or command.
 type TResponse struct {
-	ResponseData     TReceiveObjects `json:"r"`
-	ResponseFooter   []int           `json:"f"`
-	AutoStatusReport *TStatusReport  `json:"sr"`
+	ResponseData     TReceiveObjects   `json:"r"`
+	ResponseFooter   []int             `json:"f"`
+	AutoStatusReport *TStatusReport    `json:"sr"`
+	ExceptionReport  *TExceptionReport `json:"er"`
+	ProbeReport      *TProbeReport     `json:"prb"`
 }
 
 func (dst *TResponse) UpdateFrom(src *TResponse) {
@@ -135,6 +177,21 @@ func (dst *TResponse) UpdateFrom(src *TResponse) {
 	if src.AutoStatusReport != nil {
 		dst.ResponseData.StatusReport.UpdateFrom(src.AutoStatusReport)
 	}
+	if src.ExceptionReport != nil {
+		dst.ResponseData.ExceptionReport = src.ExceptionReport
+	}
+	if src.ProbeReport != nil {
+		dst.ResponseData.ProbeReport = src.ProbeReport
+	}
+}
+
+// Exception returns the exception report contained in the response,
+// either sent asynchronously or as part of a response body, or nil.
+func (o *TResponse) Exception() *TExceptionReport {
+	if o.ExceptionReport != nil {
+		return o.ExceptionReport
+	}
+	return o.ResponseData.ExceptionReport
 }
 
 func (o *TResponse) Json() (jsonOut []byte) {
@@ -145,6 +202,39 @@ func (o *TResponse) Json() (jsonOut []byte) {
 	return
 }
 
+// Probe returns the probe report contained in the response,
+// either sent asynchronously or as part of a response body, or nil.
+func (o *TResponse) Probe() *TProbeReport {
+	if o.ProbeReport != nil {
+		return o.ProbeReport
+	}
+	return o.ResponseData.ProbeReport
+}
+
+// NamedJson returns the same data as Json, extended by an object "n" holding
+// the symbolic names of all enumerated values, e.g. {"stat":"run","coor":"G54"}.
+func (o *TResponse) NamedJson() (jsonOut []byte) {
+	names := o.ResponseData.StatusReport.Names()
+	if o.ResponseData.RxMode != nil {
+		names["rxm"] = o.ResponseData.RxMode.String()
+	}
+	if o.ResponseData.ExceptionReport != nil {
+		names["er"] = o.ResponseData.ExceptionReport.Status.String()
+	}
+	if len(o.ResponseFooter) == 3 {
+		names["f"] = TResponseStatusCode(o.ResponseFooter[1]).String()
+	}
+	named := struct {
+		*TResponse
+		Names map[string]string `json:"n"`
+	}{o, names}
+	jsonOut, err := jsjson.Marshal(named)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
 // ParseResponse parses raw json data to a TResponse.
 func ParseResponse(data []byte) (rsp *TResponse, err error) {
 	rsp = &TResponse{}
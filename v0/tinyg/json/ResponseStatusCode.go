@@ -173,3 +173,327 @@ const (
 	StatusProbeEndpoint      TResponseStatusCode = 251
 	StatusJoggingCycleFailed TResponseStatusCode = 252
 )
+
+var statusMessages = map[TResponseStatusCode]string{
+	StatusOk:                                "OK",
+	StatusError:                             "Error",
+	StatusEagain:                            "Eagain",
+	StatusNoop:                              "No operation performed",
+	StatusComplete:                          "Completed operation",
+	StatusTerminate:                         "Operation terminated",
+	StatusReset:                             "Operation was hard reset",
+	StatusEol:                               "Returned end-of-line",
+	StatusEof:                               "Returned end-of-file",
+	StatusFileNotOpen:                       "File not open",
+	StatusFileSizeExceeded:                  "Max file size exceeded",
+	StatusNoSuchDevice:                      "No such device",
+	StatusBufferEmpty:                       "Buffer empty",
+	StatusBufferFull:                        "Buffer full",
+	StatusBufferFullFatal:                   "Buffer full - fatal",
+	StatusInitializing:                      "Initializing - try again",
+	StatusEnteringBootLoader:                "Entering boot loader",
+	StatusFunctionIsStubbed:                 "Function is stubbed",
+	StatusInternalError:                     "Internal error",
+	StatusInternalRangeError:                "Internal range error",
+	StatusFloatingPointError:                "Floating point error",
+	StatusDivideByZero:                      "Divide by zero",
+	StatusInvalidAddress:                    "Invalid address",
+	StatusReadOnlyAddress:                   "Read-only address",
+	StatusInitFail:                          "Initialization failure",
+	StatusAlarmed:                           "System alarm - shutting down",
+	StatusFailedToGetPlannerBuffer:          "Failed to get planner buffer",
+	StatusGenericExceptionReport:            "Generic exception report",
+	StatusPrepLineMoveTimeIsInfinite:        "Move time is infinite",
+	StatusPrepLineMoveTimeIsNan:             "Move time is NAN",
+	StatusFloatIsInfinite:                   "Float is infinite",
+	StatusFloatIsNan:                        "Float is NAN",
+	StatusPersistenceError:                  "Persistence error",
+	StatusBadStatusReportSetting:            "Bad status report setting",
+	StatusConfigAssertionFailure:            "Config assertion failure",
+	StatusXioAssertionFailure:               "XIO assertion failure",
+	StatusEncoderAssertionFailure:           "Encoder assertion failure",
+	StatusStepperAssertionFailure:           "Stepper assertion failure",
+	StatusPlannerAssertionFailure:           "Planner assertion failure",
+	StatusCanonicalMachine:                  "Canonical machine assertion failure",
+	StatusControllerAssertionFailure:        "Controller assertion failure",
+	StatusStackOverflow:                     "Stack overflow detected",
+	StatusMemoryFault:                       "Memory fault detected",
+	StatusGenericAssertionFailure:           "Generic assertion failure",
+	StatusUnrecognizedName:                  "Unrecognized command or config name",
+	StatusInvalidOrMalformedCommand:         "Invalid or malformed command",
+	StatusBadNumberFormat:                   "Bad number format",
+	StatusBadUnsupportedType:                "Unsupported number or JSON type",
+	StatusParameterIsReadOnly:               "Parameter is read-only",
+	StatusParameterCannotBeRead:             "Parameter cannot be read",
+	StatusCommandNotAccepted:                "Command not accepted",
+	StatusInputExceedsMaxLength:             "Input exceeds max length",
+	StatusInputLessThanMinValue:             "Input less than minimum value",
+	StatusInputExceedsMaxValue:              "Input exceeds maximum value",
+	StatusInputValueRangeError:              "Input value range error",
+	StatusJsonSyntaxError:                   "JSON syntax error",
+	StatusJsonTooManyPairs:                  "JSON input has too many pairs",
+	StatusJsonTooLong:                       "JSON string too long",
+	StatusGcodeGenericInputError:            "Generic Gcode input error",
+	StatusGcodeCommandUnsupported:           "Gcode command unsupported",
+	StatusMcodeCommandUnsupported:           "M code unsupported",
+	StatusGcodeModalGroupViolation:          "Gcode modal group violation",
+	StatusGcodeAxisIsMissing:                "Axis word missing",
+	StatusGcodeAxisCannotBePresent:          "Axis cannot be present",
+	StatusGcodeAxisIsInvalid:                "Axis is invalid for this command",
+	StatusGcodeAxisIsNotConfigured:          "Axis is disabled",
+	StatusGcodeAxisNumberIsMissing:          "Axis target position is missing",
+	StatusGcodeAxisNumberIsInvalid:          "Axis target position is invalid",
+	StatusGcodeActivePlaneIsMissing:         "Selected plane is missing",
+	StatusGcodeActivePlaneIsInvalid:         "Selected plane is invalid",
+	StatusGcodeFeedrateNotSpecified:         "Feedrate not specified",
+	StatusGcodeInverseTimeMode:              "Inverse time mode cannot be used with this command",
+	StatusGcodeRotaryAxis:                   "Rotary axes cannot be used with this command",
+	StatusGcodeG53WithoutG0OrG1:             "G0 or G1 must be active for G53",
+	StatusRequestedVelocity:                 "Requested velocity exceeds limits",
+	StatusCutterCompensation:                "Cutter compensation cannot be enabled",
+	StatusProgrammedPoint:                   "Programmed point same as current point",
+	StatusSpindleSpeedBelowMinimum:          "Spindle speed below minimum",
+	StatusSpindleSpeedMaxExceeded:           "Spindle speed exceeded maximum",
+	StatusSWordIsMissing:                    "S word is missing",
+	StatusSWordIsInvalid:                    "S word is invalid",
+	StatusSpindleMustBeOff:                  "Spindle must be off for this command",
+	StatusSpindleMustBeTurning:              "Spindle must be turning for this command",
+	StatusArcSpecificationError:             "Arc specification error",
+	StatusArcAxisMissing:                    "Arc specification error - missing axis(es)",
+	StatusArcOffsetsMissing:                 "Arc specification error - missing offset(s)",
+	StatusArcRadius:                         "Arc specification error - radius arc out of tolerance",
+	StatusArcEndpoint:                       "Arc specification error - endpoint is starting point",
+	StatusPWordIsMissing:                    "P word is missing",
+	StatusPWordIsInvalid:                    "P word is invalid",
+	StatusPWordIsZero:                       "P word is zero",
+	StatusPWordIsNegative:                   "P word is negative",
+	StatusPWordIsNotAnInteger:               "P word is not an integer",
+	StatusPWordIsNotValidToolNumber:         "P word is not a valid tool number",
+	StatusDWordIsMissing:                    "D word is missing",
+	StatusDWordIsInvalid:                    "D word is invalid",
+	StatusEWordIsMissing:                    "E word is missing",
+	StatusEWordIsInvalid:                    "E word is invalid",
+	StatusHWordIsMissing:                    "H word is missing",
+	StatusHWordIsInvalid:                    "H word is invalid",
+	StatusLWordIsMissing:                    "L word is missing",
+	StatusLWordIsInvalid:                    "L word is invalid",
+	StatusQWordIsMissing:                    "Q word is missing",
+	StatusQWordIsInvalid:                    "Q word is invalid",
+	StatusRWordIsMissing:                    "R word is missing",
+	StatusRWordIsInvalid:                    "R word is invalid",
+	StatusTWordIsMissing:                    "T word is missing",
+	StatusTWordIsInvalid:                    "T word is invalid",
+	StatusGenericError:                      "Generic error",
+	StatusMinimumLengthMove:                 "Move less than minimum length",
+	StatusMinimumTimeMove:                   "Move less than minimum time",
+	StatusMachineAlarmed:                    "Machine is alarmed - command not processed",
+	StatusLimitSwitchHit:                    "Limit switch hit - shutdown occurred",
+	StatusPlannerFailedToConverge:           "Trapezoid planner failed to converge",
+	StatusSoftLimitExceeded:                 "Soft limit exceeded",
+	StatusSoftLimitExceededXmin:             "Soft limit exceeded - X min",
+	StatusSoftLimitExceededXmax:             "Soft limit exceeded - X max",
+	StatusSoftLimitExceededYmin:             "Soft limit exceeded - Y min",
+	StatusSoftLimitExceededYmax:             "Soft limit exceeded - Y max",
+	StatusSoftLimitExceededZmin:             "Soft limit exceeded - Z min",
+	StatusSoftLimitExceededZmax:             "Soft limit exceeded - Z max",
+	StatusSoftLimitExceededAmin:             "Soft limit exceeded - A min",
+	StatusSoftLimitExceededAmax:             "Soft limit exceeded - A max",
+	StatusSoftLimitExceededBmin:             "Soft limit exceeded - B min",
+	StatusSoftLimitExceededBmax:             "Soft limit exceeded - B max",
+	StatusSoftLimitExceededCmin:             "Soft limit exceeded - C min",
+	StatusSoftLimitExceededCmax:             "Soft limit exceeded - C max",
+	StatusHomingCycleFailed:                 "Homing cycle failed",
+	StatusHomingErrorBadOrNoAxis:            "Homing error - bad or no axis specified",
+	StatusHomingErrorSwitchMisconfiguration: "Homing error - switch misconfiguration",
+	StatusHomingErrorZeroSearchVelocity:     "Homing error - zero search velocity",
+	StatusHomingErrorZeroLatchVelocity:      "Homing error - zero latch velocity",
+	StatusHomingErrorTravelMinMaxIdentical:  "Homing error - travel min and max are the same",
+	StatusHomingErrorNegativeLatchBackoff:   "Homing error - negative latch backoff",
+	StatusHomingErrorSearchFailed:           "Homing error - search failed",
+	StatusProbeCycleFailed:                  "Probe cycle failed",
+	StatusProbeEndpoint:                     "Probe endpoint is starting point",
+	StatusJoggingCycleFailed:                "Jogging cycle failed",
+}
+
+// Message returns the human-readable description of a status code
+// as it is documented for the TinyG firmware.
+func (o TResponseStatusCode) Message() string {
+	if msg, ok := statusMessages[o]; ok {
+		return msg
+	}
+	return "Unknown status code"
+}
+
+var statusNames = enumNames{
+	int(StatusOk):                                "ok",
+	int(StatusError):                             "error",
+	int(StatusEagain):                            "eagain",
+	int(StatusNoop):                              "noop",
+	int(StatusComplete):                          "complete",
+	int(StatusTerminate):                         "terminate",
+	int(StatusReset):                             "reset",
+	int(StatusEol):                               "eol",
+	int(StatusEof):                               "eof",
+	int(StatusFileNotOpen):                       "file_not_open",
+	int(StatusFileSizeExceeded):                  "file_size_exceeded",
+	int(StatusNoSuchDevice):                      "no_such_device",
+	int(StatusBufferEmpty):                       "buffer_empty",
+	int(StatusBufferFull):                        "buffer_full",
+	int(StatusBufferFullFatal):                   "buffer_full_fatal",
+	int(StatusInitializing):                      "initializing",
+	int(StatusEnteringBootLoader):                "entering_boot_loader",
+	int(StatusFunctionIsStubbed):                 "function_is_stubbed",
+	int(StatusInternalError):                     "internal_error",
+	int(StatusInternalRangeError):                "internal_range_error",
+	int(StatusFloatingPointError):                "floating_point_error",
+	int(StatusDivideByZero):                      "divide_by_zero",
+	int(StatusInvalidAddress):                    "invalid_address",
+	int(StatusReadOnlyAddress):                   "read_only_address",
+	int(StatusInitFail):                          "init_fail",
+	int(StatusAlarmed):                           "alarmed",
+	int(StatusFailedToGetPlannerBuffer):          "failed_to_get_planner_buffer",
+	int(StatusGenericExceptionReport):            "generic_exception_report",
+	int(StatusPrepLineMoveTimeIsInfinite):        "prep_line_move_time_is_infinite",
+	int(StatusPrepLineMoveTimeIsNan):             "prep_line_move_time_is_nan",
+	int(StatusFloatIsInfinite):                   "float_is_infinite",
+	int(StatusFloatIsNan):                        "float_is_nan",
+	int(StatusPersistenceError):                  "persistence_error",
+	int(StatusBadStatusReportSetting):            "bad_status_report_setting",
+	int(StatusConfigAssertionFailure):            "config_assertion_failure",
+	int(StatusXioAssertionFailure):               "xio_assertion_failure",
+	int(StatusEncoderAssertionFailure):           "encoder_assertion_failure",
+	int(StatusStepperAssertionFailure):           "stepper_assertion_failure",
+	int(StatusPlannerAssertionFailure):           "planner_assertion_failure",
+	int(StatusCanonicalMachine):                  "canonical_machine",
+	int(StatusControllerAssertionFailure):        "controller_assertion_failure",
+	int(StatusStackOverflow):                     "stack_overflow",
+	int(StatusMemoryFault):                       "memory_fault",
+	int(StatusGenericAssertionFailure):           "generic_assertion_failure",
+	int(StatusUnrecognizedName):                  "unrecognized_name",
+	int(StatusInvalidOrMalformedCommand):         "invalid_or_malformed_command",
+	int(StatusBadNumberFormat):                   "bad_number_format",
+	int(StatusBadUnsupportedType):                "bad_unsupported_type",
+	int(StatusParameterIsReadOnly):               "parameter_is_read_only",
+	int(StatusParameterCannotBeRead):             "parameter_cannot_be_read",
+	int(StatusCommandNotAccepted):                "command_not_accepted",
+	int(StatusInputExceedsMaxLength):             "input_exceeds_max_length",
+	int(StatusInputLessThanMinValue):             "input_less_than_min_value",
+	int(StatusInputExceedsMaxValue):              "input_exceeds_max_value",
+	int(StatusInputValueRangeError):              "input_value_range_error",
+	int(StatusJsonSyntaxError):                   "json_syntax_error",
+	int(StatusJsonTooManyPairs):                  "json_too_many_pairs",
+	int(StatusJsonTooLong):                       "json_too_long",
+	int(StatusGcodeGenericInputError):            "gcode_generic_input_error",
+	int(StatusGcodeCommandUnsupported):           "gcode_command_unsupported",
+	int(StatusMcodeCommandUnsupported):           "mcode_command_unsupported",
+	int(StatusGcodeModalGroupViolation):          "gcode_modal_group_violation",
+	int(StatusGcodeAxisIsMissing):                "gcode_axis_is_missing",
+	int(StatusGcodeAxisCannotBePresent):          "gcode_axis_cannot_be_present",
+	int(StatusGcodeAxisIsInvalid):                "gcode_axis_is_invalid",
+	int(StatusGcodeAxisIsNotConfigured):          "gcode_axis_is_not_configured",
+	int(StatusGcodeAxisNumberIsMissing):          "gcode_axis_number_is_missing",
+	int(StatusGcodeAxisNumberIsInvalid):          "gcode_axis_number_is_invalid",
+	int(StatusGcodeActivePlaneIsMissing):         "gcode_active_plane_is_missing",
+	int(StatusGcodeActivePlaneIsInvalid):         "gcode_active_plane_is_invalid",
+	int(StatusGcodeFeedrateNotSpecified):         "gcode_feedrate_not_specified",
+	int(StatusGcodeInverseTimeMode):              "gcode_inverse_time_mode",
+	int(StatusGcodeRotaryAxis):                   "gcode_rotary_axis",
+	int(StatusGcodeG53WithoutG0OrG1):             "gcode_g53_without_g0_or_g1",
+	int(StatusRequestedVelocity):                 "requested_velocity",
+	int(StatusCutterCompensation):                "cutter_compensation",
+	int(StatusProgrammedPoint):                   "programmed_point",
+	int(StatusSpindleSpeedBelowMinimum):          "spindle_speed_below_minimum",
+	int(StatusSpindleSpeedMaxExceeded):           "spindle_speed_max_exceeded",
+	int(StatusSWordIsMissing):                    "sword_is_missing",
+	int(StatusSWordIsInvalid):                    "sword_is_invalid",
+	int(StatusSpindleMustBeOff):                  "spindle_must_be_off",
+	int(StatusSpindleMustBeTurning):              "spindle_must_be_turning",
+	int(StatusArcSpecificationError):             "arc_specification_error",
+	int(StatusArcAxisMissing):                    "arc_axis_missing",
+	int(StatusArcOffsetsMissing):                 "arc_offsets_missing",
+	int(StatusArcRadius):                         "arc_radius",
+	int(StatusArcEndpoint):                       "arc_endpoint",
+	int(StatusPWordIsMissing):                    "pword_is_missing",
+	int(StatusPWordIsInvalid):                    "pword_is_invalid",
+	int(StatusPWordIsZero):                       "pword_is_zero",
+	int(StatusPWordIsNegative):                   "pword_is_negative",
+	int(StatusPWordIsNotAnInteger):               "pword_is_not_an_integer",
+	int(StatusPWordIsNotValidToolNumber):         "pword_is_not_valid_tool_number",
+	int(StatusDWordIsMissing):                    "dword_is_missing",
+	int(StatusDWordIsInvalid):                    "dword_is_invalid",
+	int(StatusEWordIsMissing):                    "eword_is_missing",
+	int(StatusEWordIsInvalid):                    "eword_is_invalid",
+	int(StatusHWordIsMissing):                    "hword_is_missing",
+	int(StatusHWordIsInvalid):                    "hword_is_invalid",
+	int(StatusLWordIsMissing):                    "lword_is_missing",
+	int(StatusLWordIsInvalid):                    "lword_is_invalid",
+	int(StatusQWordIsMissing):                    "qword_is_missing",
+	int(StatusQWordIsInvalid):                    "qword_is_invalid",
+	int(StatusRWordIsMissing):                    "rword_is_missing",
+	int(StatusRWordIsInvalid):                    "rword_is_invalid",
+	int(StatusTWordIsMissing):                    "tword_is_missing",
+	int(StatusTWordIsInvalid):                    "tword_is_invalid",
+	int(StatusGenericError):                      "generic_error",
+	int(StatusMinimumLengthMove):                 "minimum_length_move",
+	int(StatusMinimumTimeMove):                   "minimum_time_move",
+	int(StatusMachineAlarmed):                    "machine_alarmed",
+	int(StatusLimitSwitchHit):                    "limit_switch_hit",
+	int(StatusPlannerFailedToConverge):           "planner_failed_to_converge",
+	int(StatusSoftLimitExceeded):                 "soft_limit_exceeded",
+	int(StatusSoftLimitExceededXmin):             "soft_limit_exceeded_xmin",
+	int(StatusSoftLimitExceededXmax):             "soft_limit_exceeded_xmax",
+	int(StatusSoftLimitExceededYmin):             "soft_limit_exceeded_ymin",
+	int(StatusSoftLimitExceededYmax):             "soft_limit_exceeded_ymax",
+	int(StatusSoftLimitExceededZmin):             "soft_limit_exceeded_zmin",
+	int(StatusSoftLimitExceededZmax):             "soft_limit_exceeded_zmax",
+	int(StatusSoftLimitExceededAmin):             "soft_limit_exceeded_amin",
+	int(StatusSoftLimitExceededAmax):             "soft_limit_exceeded_amax",
+	int(StatusSoftLimitExceededBmin):             "soft_limit_exceeded_bmin",
+	int(StatusSoftLimitExceededBmax):             "soft_limit_exceeded_bmax",
+	int(StatusSoftLimitExceededCmin):             "soft_limit_exceeded_cmin",
+	int(StatusSoftLimitExceededCmax):             "soft_limit_exceeded_cmax",
+	int(StatusHomingCycleFailed):                 "homing_cycle_failed",
+	int(StatusHomingErrorBadOrNoAxis):            "homing_error_bad_or_no_axis",
+	int(StatusHomingErrorSwitchMisconfiguration): "homing_error_switch_misconfiguration",
+	int(StatusHomingErrorZeroSearchVelocity):     "homing_error_zero_search_velocity",
+	int(StatusHomingErrorZeroLatchVelocity):      "homing_error_zero_latch_velocity",
+	int(StatusHomingErrorTravelMinMaxIdentical):  "homing_error_travel_min_max_identical",
+	int(StatusHomingErrorNegativeLatchBackoff):   "homing_error_negative_latch_backoff",
+	int(StatusHomingErrorSearchFailed):           "homing_error_search_failed",
+	int(StatusProbeCycleFailed):                  "probe_cycle_failed",
+	int(StatusProbeEndpoint):                     "probe_endpoint",
+	int(StatusJoggingCycleFailed):                "jogging_cycle_failed",
+}
+
+// String returns the symbolic name of the value.
+func (o TResponseStatusCode) String() string {
+	return statusNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TResponseStatusCode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TResponseStatusCode) UnmarshalText(text []byte) error {
+	value, err := statusNames.parse(string(text))
+	if err == nil {
+		*o = TResponseStatusCode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TResponseStatusCode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TResponseStatusCode) UnmarshalJSON(data []byte) error {
+	value, err := statusNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TResponseStatusCode(value)
+	}
+	return err
+}
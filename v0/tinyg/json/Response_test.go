@@ -1,6 +1,9 @@
 package json
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 const jsonExampleAbsMachinePos string = `{"r":{"mpo":{"x":3.000,"y":0.000,"z":0.000,"a":0.000,"b":0.000,"c":0.000}},"f":[3,0,10]}`
 
@@ -36,3 +39,92 @@ func TestUpdateFrom(t *testing.T) {
 		}
 	}
 }
+
+const jsonExampleExceptionReport string = `{"er":{"fb":440.20,"st":204,"msg":"Limit switch hit - Shutdown occurred"}}`
+
+func TestParseExceptionReport(t *testing.T) {
+	dut, err := ParseResponse([]byte(jsonExampleExceptionReport))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	er := dut.Exception()
+	if er == nil {
+		t.Error("Exception report is nil")
+		t.FailNow()
+	}
+	if er.Status != StatusLimitSwitchHit {
+		t.Error("Exception report status != StatusLimitSwitchHit")
+	}
+	dst := TResponse{}
+	dst.UpdateFrom(dut)
+	if dst.ResponseData.ExceptionReport == nil || dst.ResponseData.ExceptionReport.Status != StatusLimitSwitchHit {
+		t.Error("Exception report not stored by UpdateFrom")
+	}
+}
+
+func TestStatusCodeMessage(t *testing.T) {
+	if StatusAlarmed.Message() != "System alarm - shutting down" {
+		t.Error("StatusAlarmed has wrong message")
+	}
+	if TResponseStatusCode(255).Message() != "Unknown status code" {
+		t.Error("Unknown status code has wrong message")
+	}
+}
+
+const jsonExampleStatusReport string = `{"sr":{"line":12,"stat":5,"unit":1,"coor":1,"dist":0}}`
+
+func TestEnumNames(t *testing.T) {
+	if StateRun.String() != "run" || CoordinateSystemG54.String() != "G54" || UnitsMM.String() != "mm" {
+		t.Error("Wrong symbolic names")
+	}
+	if StatusLimitSwitchHit.String() != "limit_switch_hit" {
+		t.Error("Wrong status code name: ", StatusLimitSwitchHit.String())
+	}
+	var state TMachineState
+	if err := state.UnmarshalText([]byte("hold")); err != nil || state != StateHold {
+		t.Error("UnmarshalText failed for hold")
+	}
+	if err := state.UnmarshalText([]byte("nonsense")); err == nil {
+		t.Error("UnmarshalText accepted an unknown name")
+	}
+	if TMachineState(42).String() != "42" {
+		t.Error("Unknown values have to be printed as number")
+	}
+}
+
+func TestNamedJson(t *testing.T) {
+	src, err := ParseResponse([]byte(jsonExampleStatusReport))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	dst := TResponse{}
+	dst.UpdateFrom(src)
+	if !strings.Contains(string(dst.Json()), `"stat":5`) {
+		t.Error("Json has to keep numeric values: ", string(dst.Json()))
+	}
+	named := string(dst.NamedJson())
+	if !strings.Contains(named, `"stat":5`) || !strings.Contains(named, `"stat":"run"`) ||
+		!strings.Contains(named, `"coor":"G54"`) || !strings.Contains(named, `"unit":"mm"`) {
+		t.Error("NamedJson is missing values: ", named)
+	}
+}
+
+const jsonExampleProbeReport string = `{"prb":{"e":1,"x":10.000,"y":20.000,"z":-3.125}}`
+
+func TestParseProbeReport(t *testing.T) {
+	dut, err := ParseResponse([]byte(jsonExampleProbeReport))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	prb := dut.Probe()
+	if prb == nil {
+		t.Error("Probe report is nil")
+		t.FailNow()
+	}
+	if !prb.Ok() || prb.Z != -3.125 || prb.X != 10.0 {
+		t.Error("Probe report has wrong values: ", *prb)
+	}
+}
@@ -22,3 +22,41 @@ const (
 	RxModeStream TRxMode = 0
 	RxModeLine   TRxMode = 1
 )
+
+var rxModeNames = enumNames{
+	int(RxModeStream): "stream",
+	int(RxModeLine):   "line",
+}
+
+// String returns the symbolic name of the value.
+func (o TRxMode) String() string {
+	return rxModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TRxMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TRxMode) UnmarshalText(text []byte) error {
+	value, err := rxModeNames.parse(string(text))
+	if err == nil {
+		*o = TRxMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TRxMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TRxMode) UnmarshalJSON(data []byte) error {
+	value, err := rxModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TRxMode(value)
+	}
+	return err
+}
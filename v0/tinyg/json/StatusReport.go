@@ -85,3 +85,37 @@ func (dst *TStatusReport) UpdateFrom(src *TStatusReport) {
 		dst.WorkingPositionZ = src.WorkingPositionZ
 	}
 }
+
+// Names returns the symbolic names of all enumerated values
+// which are set, keyed by their JSON name.
+func (o *TStatusReport) Names() (names map[string]string) {
+	names = make(map[string]string)
+	if o == nil {
+		return
+	}
+	if o.MachineState != nil {
+		names["stat"] = o.MachineState.String()
+	}
+	if o.UnitsMode != nil {
+		names["unit"] = o.UnitsMode.String()
+	}
+	if o.CoordinateSystem != nil {
+		names["coor"] = o.CoordinateSystem.String()
+	}
+	if o.MotionMode != nil {
+		names["momo"] = o.MotionMode.String()
+	}
+	if o.PlaneSelect != nil {
+		names["plan"] = o.PlaneSelect.String()
+	}
+	if o.PathMode != nil {
+		names["path"] = o.PathMode.String()
+	}
+	if o.DistanceMode != nil {
+		names["dist"] = o.DistanceMode.String()
+	}
+	if o.FeedRateMode != nil {
+		names["frmo"] = o.FeedRateMode.String()
+	}
+	return
+}
@@ -22,3 +22,41 @@ const (
 	UnitsInch TUnitsMode = 0
 	UnitsMM   TUnitsMode = 1
 )
+
+var unitsModeNames = enumNames{
+	int(UnitsInch): "in",
+	int(UnitsMM):   "mm",
+}
+
+// String returns the symbolic name of the value.
+func (o TUnitsMode) String() string {
+	return unitsModeNames.name(int(o))
+}
+
+// MarshalText encodes the value by its symbolic name.
+func (o TUnitsMode) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts a symbolic name or a number.
+func (o *TUnitsMode) UnmarshalText(text []byte) error {
+	value, err := unitsModeNames.parse(string(text))
+	if err == nil {
+		*o = TUnitsMode(value)
+	}
+	return err
+}
+
+// MarshalJSON keeps the numeric encoding used by TinyG.
+func (o TUnitsMode) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(int(o))
+}
+
+// UnmarshalJSON accepts numbers as sent by TinyG as well as symbolic names.
+func (o *TUnitsMode) UnmarshalJSON(data []byte) error {
+	value, err := unitsModeNames.unmarshalJSON(data)
+	if err == nil {
+		*o = TUnitsMode(value)
+	}
+	return err
+}
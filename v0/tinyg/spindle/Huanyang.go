@@ -0,0 +1,109 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package spindle
+
+import (
+	"github.com/golang/glog"
+	"github.com/itschleemilch/huanyango/v1/vfdio"
+	"sync"
+	"time"
+)
+
+// hyTripDelay is the time after a speed change before a missing output
+// frequency is considered a fault.
+const hyTripDelay time.Duration = 3 * time.Second
+
+// THuanyang drives a Huanyang VFD through the huanyango library.
+type THuanyang struct {
+	Vfd       *vfdio.HyInverter
+	Tolerance float64
+	lock      sync.Mutex
+	state     TCommandState
+	changed   time.Time
+}
+
+// NewHuanyang wraps an opened VFD.
+func NewHuanyang(vfd *vfdio.HyInverter) *THuanyang {
+	return &THuanyang{Vfd: vfd, Tolerance: DefaultTolerance}
+}
+
+// gcode passes a command to the VFD processor and waits until it is handled.
+func (o *THuanyang) gcode(cmd string) error {
+	o.Vfd.GCodeWaiting(cmd)
+	vfdOk, _, _ := o.Vfd.Processed()
+	glog.Infoln("Vfd waiting for processing...")
+	for !vfdOk {
+		time.Sleep(5 * time.Millisecond)
+		vfdOk, _, _ = o.Vfd.Processed()
+	}
+	glog.Infoln("Vfd handled.")
+	return nil
+}
+
+func (o *THuanyang) SetSpeed(rpm float64, direction TDirection) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.state = TCommandState{Rpm: rpm, Direction: direction}
+	o.changed = time.Now()
+	return o.gcode(o.state.String())
+}
+
+func (o *THuanyang) Stop() error {
+	return o.SetSpeed(0, DirectionStop)
+}
+
+func (o *THuanyang) Setpoint() (float64, TDirection) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state.Rpm, o.state.Direction
+}
+
+func (o *THuanyang) ActualRpm() float64 {
+	return float64(o.Vfd.OutputRpm())
+}
+
+func (o *THuanyang) AtSpeed() bool {
+	rpm, direction := o.Setpoint()
+	return atSpeed(o.ActualRpm(), rpm, direction, o.Tolerance)
+}
+
+// Fault reports a tripped VFD. The library does not expose the fault
+// register, so a running setpoint without output frequency is used.
+func (o *THuanyang) Fault() error {
+	o.lock.Lock()
+	running := o.state.Direction != DirectionStop && o.state.Rpm > 0 && time.Since(o.changed) > hyTripDelay
+	o.lock.Unlock()
+	if running && o.Vfd.FrequencySet() > 0 && o.Vfd.OutputFrequency() == 0 {
+		return ErrDriveTripped
+	}
+	return nil
+}
+
+// OutputFrequency returns the measured output frequency of the VFD.
+func (o *THuanyang) OutputFrequency() float64 {
+	return float64(o.Vfd.OutputFrequency())
+}
+
+// FrequencySet returns the frequency setpoint of the VFD.
+func (o *THuanyang) FrequencySet() float64 {
+	return float64(o.Vfd.FrequencySet())
+}
+
+func (o *THuanyang) Close() error {
+	o.Vfd.Close()
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package spindle
+
+import (
+	"sync"
+	"time"
+)
+
+// TPwm is a spindle driven by TinyG's PWM output. TinyG executes the
+// M3, M4, M5 and S words of the program itself, so this driver only
+// tracks the commanded state. Without feedback the spindle is assumed
+// to be at speed after the spin-up time.
+type TPwm struct {
+	SpinUp  time.Duration
+	lock    sync.Mutex
+	state   TCommandState
+	changed time.Time
+}
+
+// NewPwm creates a PWM spindle with the given spin-up time.
+func NewPwm(spinUp time.Duration) *TPwm {
+	return &TPwm{SpinUp: spinUp}
+}
+
+func (o *TPwm) SetSpeed(rpm float64, direction TDirection) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	state := TCommandState{Rpm: rpm, Direction: direction}
+	if state != o.state {
+		o.state = state
+		o.changed = time.Now()
+	}
+	return nil
+}
+
+func (o *TPwm) Stop() error {
+	return o.SetSpeed(0, DirectionStop)
+}
+
+func (o *TPwm) Setpoint() (float64, TDirection) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state.Rpm, o.state.Direction
+}
+
+func (o *TPwm) ActualRpm() float64 {
+	rpm, direction := o.Setpoint()
+	if direction == DirectionStop || !o.AtSpeed() {
+		return 0
+	}
+	return rpm
+}
+
+func (o *TPwm) AtSpeed() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state.Direction == DirectionStop || time.Since(o.changed) >= o.SpinUp
+}
+
+func (o *TPwm) Fault() error {
+	return nil
+}
+
+func (o *TPwm) Close() error {
+	return nil
+}
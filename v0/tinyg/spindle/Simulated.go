@@ -0,0 +1,109 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package spindle
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TSimulated is a spindle without hardware. The speed ramps linearly
+// with Acceleration (RPM per second) towards the setpoint, which makes
+// it usable for tests and dry runs.
+type TSimulated struct {
+	Acceleration float64
+	Tolerance    float64
+	lock         sync.Mutex
+	state        TCommandState
+	rpm          float64
+	updated      time.Time
+	now          func() time.Time
+	fault        error
+}
+
+// NewSimulated creates a simulated spindle.
+func NewSimulated(acceleration float64) *TSimulated {
+	return &TSimulated{Acceleration: acceleration, Tolerance: DefaultTolerance, now: time.Now}
+}
+
+// ramp advances the simulated speed to the current time, requires lock.
+func (o *TSimulated) ramp() {
+	now := o.now()
+	target := 0.0
+	if o.state.Direction != DirectionStop && o.fault == nil {
+		target = o.state.Rpm
+	}
+	step := o.Acceleration * now.Sub(o.updated).Seconds()
+	if o.Acceleration <= 0 || math.Abs(target-o.rpm) <= step {
+		o.rpm = target
+	} else if target > o.rpm {
+		o.rpm += step
+	} else {
+		o.rpm -= step
+	}
+	o.updated = now
+}
+
+func (o *TSimulated) SetSpeed(rpm float64, direction TDirection) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.ramp()
+	o.state = TCommandState{Rpm: rpm, Direction: direction}
+	return nil
+}
+
+func (o *TSimulated) Stop() error {
+	return o.SetSpeed(0, DirectionStop)
+}
+
+func (o *TSimulated) Setpoint() (float64, TDirection) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state.Rpm, o.state.Direction
+}
+
+func (o *TSimulated) ActualRpm() float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.ramp()
+	return o.rpm
+}
+
+func (o *TSimulated) AtSpeed() bool {
+	rpm, direction := o.Setpoint()
+	return atSpeed(o.ActualRpm(), rpm, direction, o.Tolerance)
+}
+
+func (o *TSimulated) Fault() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.fault
+}
+
+// SetFault simulates a tripped drive, the spindle coasts down until the
+// fault is reset with nil.
+func (o *TSimulated) SetFault(fault error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.ramp()
+	o.fault = fault
+}
+
+func (o *TSimulated) Close() error {
+	return nil
+}
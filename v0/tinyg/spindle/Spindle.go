@@ -0,0 +1,115 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package spindle
+
+import (
+	"errors"
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	"math"
+	"strconv"
+)
+
+var ErrDriveTripped = errors.New("spindle drive tripped")
+
+// DefaultTolerance is the relative deviation from the setpoint which is
+// still considered to be at speed.
+const DefaultTolerance float64 = 0.05
+
+// TDirection is the commanded direction of rotation.
+type TDirection int
+
+const (
+	DirectionStop TDirection = 0
+	DirectionCW   TDirection = 1 // M3
+	DirectionCCW  TDirection = 2 // M4
+)
+
+func (o TDirection) String() string {
+	switch o {
+	case DirectionCW:
+		return "M3"
+	case DirectionCCW:
+		return "M4"
+	}
+	return "M5"
+}
+
+// Spindle is implemented by all spindle drivers.
+type Spindle interface {
+	// SetSpeed commands speed and direction, DirectionStop stops the spindle.
+	SetSpeed(rpm float64, direction TDirection) error
+	// Stop stops the spindle.
+	Stop() error
+	// Setpoint returns the commanded speed and direction.
+	Setpoint() (rpm float64, direction TDirection)
+	// ActualRpm returns the measured speed, or the expected speed if the
+	// drive has no feedback.
+	ActualRpm() float64
+	// AtSpeed is true if the spindle runs at the commanded speed or is stopped.
+	AtSpeed() bool
+	// Fault returns an error if the drive reports a fault.
+	Fault() error
+	Close() error
+}
+
+// atSpeed compares a measured speed with the setpoint using the relative tolerance.
+func atSpeed(actual, setpoint float64, direction TDirection, tolerance float64) bool {
+	if direction == DirectionStop || setpoint <= 0 {
+		return true
+	}
+	return math.Abs(actual-setpoint) <= setpoint*tolerance
+}
+
+// TCommandState tracks the spindle state commanded by a program.
+type TCommandState struct {
+	Rpm       float64
+	Direction TDirection
+}
+
+// Apply updates the state from the M3, M4, M5 and S words of a line.
+// It returns true if the spindle has to be updated.
+func (o *TCommandState) Apply(line gcode.TLine) (changed bool) {
+	previous := *o
+	if rpm, ok := line.Value('S'); ok {
+		o.Rpm = rpm
+	}
+	switch {
+	case line.HasCode('M', 3):
+		o.Direction = DirectionCW
+	case line.HasCode('M', 4):
+		o.Direction = DirectionCCW
+	case line.HasCode('M', 5):
+		o.Direction = DirectionStop
+	}
+	return previous != *o
+}
+
+// String returns the G-code for the state, e.g. "M3 S12000".
+func (o TCommandState) String() string {
+	if o.Direction == DirectionStop {
+		return "M5"
+	}
+	return o.Direction.String() + " S" + strconv.FormatFloat(o.Rpm, 'f', -1, 64)
+}
+
+// Update sends the state to a spindle.
+func (o TCommandState) Update(spindle Spindle) error {
+	if o.Direction == DirectionStop {
+		return spindle.Stop()
+	}
+	return spindle.SetSpeed(o.Rpm, o.Direction)
+}
@@ -0,0 +1,49 @@
+package spindle
+
+import (
+	"github.com/itschleemilch/tinyg-api/v0/tinyg/gcode"
+	"testing"
+	"time"
+)
+
+func TestCommandState(t *testing.T) {
+	var state TCommandState
+	if !state.Apply(gcode.ParseLine("S12000 M3")) || state.String() != "M3 S12000" {
+		t.Error("M3 not tracked: ", state)
+	}
+	if state.Apply(gcode.ParseLine("G1 X10")) {
+		t.Error("Line without spindle words changed the state")
+	}
+	if !state.Apply(gcode.ParseLine("M5")) || state.String() != "M5" || state.Rpm != 12000 {
+		t.Error("M5 not tracked: ", state)
+	}
+}
+
+func TestSimulatedRamp(t *testing.T) {
+	now := time.Now()
+	spindle := NewSimulated(1000)
+	spindle.now = func() time.Time { return now }
+	spindle.updated = now
+	spindle.SetSpeed(2000, DirectionCW)
+	if spindle.AtSpeed() {
+		t.Error("Spindle at speed without ramp")
+	}
+	now = now.Add(time.Second)
+	if rpm := spindle.ActualRpm(); rpm != 1000 {
+		t.Error("Wrong speed after 1s: ", rpm)
+	}
+	now = now.Add(2 * time.Second)
+	if !spindle.AtSpeed() || spindle.ActualRpm() != 2000 {
+		t.Error("Spindle not at speed after 3s")
+	}
+	spindle.SetFault(ErrDriveTripped)
+	now = now.Add(time.Second)
+	if spindle.Fault() == nil || spindle.ActualRpm() != 1000 {
+		t.Error("Tripped spindle has to coast down")
+	}
+	spindle.SetFault(nil)
+	spindle.Stop()
+	if !spindle.AtSpeed() {
+		t.Error("Stopped spindle has to be at speed")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package hysim
+
+import (
+	"errors"
+)
+
+// Function codes of the Huanyang protocol.
+const (
+	FunctionReadParameter  byte = 0x01
+	FunctionWriteParameter byte = 0x02
+	FunctionWriteControl   byte = 0x03
+	FunctionReadControl    byte = 0x04
+	FunctionWriteFrequency byte = 0x05
+)
+
+// Control commands of FunctionWriteControl.
+const (
+	ControlRun     byte = 0x01
+	ControlStop    byte = 0x08
+	ControlReverse byte = 0x11
+)
+
+// Indexes of FunctionReadControl.
+const (
+	ReadSetFrequency    byte = 0x00
+	ReadOutputFrequency byte = 0x01
+	ReadOutputCurrent   byte = 0x02
+	ReadRpm             byte = 0x03
+	ReadDcVoltage       byte = 0x04
+	ReadAcVoltage       byte = 0x05
+	ReadCounter         byte = 0x06
+	ReadTemperature     byte = 0x07
+)
+
+var (
+	ErrFrameTooShort = errors.New("frame too short")
+	ErrFrameLength   = errors.New("frame length mismatch")
+	ErrFrameCrc      = errors.New("frame crc mismatch")
+)
+
+// TFrame is a request or response: address, function, length and data.
+type TFrame struct {
+	Address  byte
+	Function byte
+	Data     []byte
+}
+
+// Crc16 calculates the Modbus CRC used by Huanyang VFDs.
+func Crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Encode returns the frame including length byte and CRC (low byte first).
+func (o TFrame) Encode() []byte {
+	raw := append([]byte{o.Address, o.Function, byte(len(o.Data))}, o.Data...)
+	crc := Crc16(raw)
+	return append(raw, byte(crc), byte(crc>>8))
+}
+
+// FrameLength returns the total length of a frame from its first three bytes.
+func FrameLength(header []byte) int {
+	return 3 + int(header[2]) + 2
+}
+
+// DecodeFrame parses and verifies a complete frame.
+func DecodeFrame(raw []byte) (frame TFrame, err error) {
+	if len(raw) < 5 {
+		return frame, ErrFrameTooShort
+	}
+	if len(raw) != FrameLength(raw) {
+		return frame, ErrFrameLength
+	}
+	crc := Crc16(raw[:len(raw)-2])
+	if raw[len(raw)-2] != byte(crc) || raw[len(raw)-1] != byte(crc>>8) {
+		return frame, ErrFrameCrc
+	}
+	frame.Address = raw[0]
+	frame.Function = raw[1]
+	frame.Data = append([]byte(nil), raw[3:len(raw)-2]...)
+	return
+}
@@ -0,0 +1,47 @@
+//go:build linux
+// +build linux
+
+package hysim
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServePty(t *testing.T) {
+	master, slavePath, err := OpenPty()
+	if err != nil {
+		t.Skip("No pseudo-terminal available: ", err)
+	}
+	defer master.Close()
+	port, err := os.OpenFile(slavePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("Could not open ", slavePath, ": ", err)
+	}
+	defer port.Close()
+	if err = makeRaw(port.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	vfd := NewSimulator()
+	go vfd.Serve(master)
+
+	request := TFrame{Address: 1, Function: FunctionWriteFrequency, Data: []byte{0x27, 0x10}}
+	port.Write(request.Encode())
+	raw := make([]byte, 7)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(port, raw)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("No response from simulator")
+	}
+	response, err := DecodeFrame(raw)
+	if err != nil || response.Function != FunctionWriteFrequency || response.Data[0] != 0x27 || response.Data[1] != 0x10 {
+		t.Error("Wrong response: ", raw, err)
+	}
+}
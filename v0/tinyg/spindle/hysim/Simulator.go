@@ -0,0 +1,223 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+package hysim
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// TSimulator models a Huanyang VFD with a spindle. Frequencies are in
+// 0.01 Hz as used by the protocol.
+type TSimulator struct {
+	Address      byte
+	MaxFrequency uint16  // upper limit of the frequency setpoint
+	Acceleration float64 // Hz per second
+	RpmPerHz     float64 // spindle speed per output frequency
+	lock         sync.Mutex
+	setFrequency uint16
+	running      bool
+	reverse      bool
+	output       float64 // output frequency in Hz
+	fault        byte
+	silent       bool
+	updated      time.Time
+	now          func() time.Time
+}
+
+// NewSimulator creates a VFD at address 1 with 400 Hz maximum frequency,
+// 100 Hz/s acceleration and 60 RPM per Hz (24000 RPM at 400 Hz).
+func NewSimulator() *TSimulator {
+	return &TSimulator{
+		Address:      1,
+		MaxFrequency: 40000,
+		Acceleration: 100,
+		RpmPerHz:     60,
+		now:          time.Now,
+	}
+}
+
+// SetFault trips the VFD with a fault code. The output is switched off
+// at once, the simulated spindle stops without coasting down. Code 0
+// clears the fault.
+func (o *TSimulator) SetFault(code byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.ramp()
+	o.fault = code
+	if code != 0 {
+		o.running = false
+		o.output = 0
+	}
+}
+
+// SetSilent makes the VFD ignore all requests, e.g. a broken cable.
+func (o *TSimulator) SetSilent(silent bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.silent = silent
+}
+
+// OutputFrequency returns the current output frequency in Hz.
+func (o *TSimulator) OutputFrequency() float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.ramp()
+	return o.output
+}
+
+// FrequencySetpoint returns the frequency set by the client in Hz,
+// independent of the running state.
+func (o *TSimulator) FrequencySetpoint() float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return float64(o.setFrequency) / 100
+}
+
+// Rpm returns the current spindle speed.
+func (o *TSimulator) Rpm() float64 {
+	return o.OutputFrequency() * o.RpmPerHz
+}
+
+// ramp advances the output frequency to the current time, requires lock.
+func (o *TSimulator) ramp() {
+	now := o.now()
+	target := 0.0
+	if o.running {
+		target = float64(o.setFrequency) / 100
+	}
+	step := o.Acceleration * now.Sub(o.updated).Seconds()
+	if o.updated.IsZero() || math.Abs(target-o.output) <= step {
+		o.output = target
+	} else if target > o.output {
+		o.output += step
+	} else {
+		o.output -= step
+	}
+	o.updated = now
+}
+
+// controlStatus returns the status byte answered to control commands.
+func (o *TSimulator) controlStatus() byte {
+	var status byte
+	if o.running {
+		status |= 0x01
+	}
+	if o.reverse {
+		status |= 0x04
+	}
+	if o.fault != 0 {
+		status |= 0x80
+	}
+	return status
+}
+
+func (o *TSimulator) readControl(index byte) uint16 {
+	switch index {
+	case ReadSetFrequency:
+		return o.setFrequency
+	case ReadOutputFrequency:
+		return uint16(o.output * 100)
+	case ReadOutputCurrent:
+		return uint16(o.output / 4) // 0.1 A
+	case ReadRpm:
+		return uint16(o.output * o.RpmPerHz)
+	case ReadDcVoltage:
+		return 3110 // 0.1 V
+	case ReadAcVoltage:
+		return 2200
+	case ReadTemperature:
+		return 35
+	}
+	return 0
+}
+
+// Handle processes a request and returns the response. ok is false if
+// the VFD does not answer, e.g. for foreign addresses.
+func (o *TSimulator) Handle(request TFrame) (response TFrame, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.silent || request.Address != o.Address {
+		return
+	}
+	o.ramp()
+	response = TFrame{Address: o.Address, Function: request.Function}
+	switch request.Function {
+	case FunctionWriteControl:
+		if len(request.Data) != 1 {
+			return response, false
+		}
+		switch request.Data[0] {
+		case ControlRun:
+			o.running, o.reverse = o.fault == 0, false
+		case ControlReverse:
+			o.running, o.reverse = o.fault == 0, true
+		case ControlStop:
+			o.running = false
+		}
+		response.Data = []byte{o.controlStatus()}
+	case FunctionReadControl:
+		if len(request.Data) < 1 {
+			return response, false
+		}
+		value := o.readControl(request.Data[0])
+		response.Data = []byte{request.Data[0], byte(value >> 8), byte(value)}
+	case FunctionWriteFrequency:
+		if len(request.Data) != 2 {
+			return response, false
+		}
+		frequency := uint16(request.Data[0])<<8 | uint16(request.Data[1])
+		if frequency > o.MaxFrequency {
+			frequency = o.MaxFrequency
+		}
+		o.setFrequency = frequency
+		response.Data = []byte{byte(frequency >> 8), byte(frequency)}
+	case FunctionReadParameter, FunctionWriteParameter:
+		// parameters are not modeled, answer with the request
+		response.Data = request.Data
+	default:
+		return response, false
+	}
+	return response, true
+}
+
+// Serve answers requests read from port until it is closed. Frames with
+// a wrong CRC are dropped like on a real bus.
+func (o *TSimulator) Serve(port io.ReadWriter) error {
+	header := make([]byte, 3)
+	for {
+		if _, err := io.ReadFull(port, header); err != nil {
+			return err
+		}
+		raw := make([]byte, FrameLength(header))
+		copy(raw, header)
+		if _, err := io.ReadFull(port, raw[3:]); err != nil {
+			return err
+		}
+		request, err := DecodeFrame(raw)
+		if err != nil {
+			continue
+		}
+		if response, ok := o.Handle(request); ok {
+			if _, err = port.Write(response.Encode()); err != nil {
+				return err
+			}
+		}
+	}
+}
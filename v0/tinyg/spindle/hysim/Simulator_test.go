@@ -0,0 +1,46 @@
+package hysim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrc16(t *testing.T) {
+	if crc := Crc16([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}); crc != 0xCDC5 {
+		t.Errorf("Wrong CRC: %04X", crc)
+	}
+	raw := TFrame{Address: 1, Function: FunctionReadControl, Data: []byte{ReadRpm}}.Encode()
+	if _, err := DecodeFrame(raw); err != nil {
+		t.Error("Encoded frame not decoded: ", err)
+	}
+	raw[3]++
+	if _, err := DecodeFrame(raw); err != ErrFrameCrc {
+		t.Error("CRC error not detected")
+	}
+}
+
+func TestSimulatorRamp(t *testing.T) {
+	now := time.Now()
+	vfd := NewSimulator()
+	vfd.now = func() time.Time { return now }
+	vfd.Handle(TFrame{Address: 1, Function: FunctionWriteFrequency, Data: []byte{0x4E, 0x20}}) // 200 Hz
+	if rsp, ok := vfd.Handle(TFrame{Address: 1, Function: FunctionWriteControl, Data: []byte{ControlRun}}); !ok || rsp.Data[0]&0x01 == 0 {
+		t.Error("VFD not running")
+	}
+	now = now.Add(time.Second)
+	rsp, _ := vfd.Handle(TFrame{Address: 1, Function: FunctionReadControl, Data: []byte{ReadRpm}})
+	if rpm := int(rsp.Data[1])<<8 | int(rsp.Data[2]); rpm != 6000 {
+		t.Error("Wrong RPM after 1s: ", rpm)
+	}
+	now = now.Add(2 * time.Second)
+	if vfd.Rpm() != 12000 {
+		t.Error("Spindle not at speed after 3s: ", vfd.Rpm())
+	}
+	vfd.SetFault(1)
+	if rsp, _ := vfd.Handle(TFrame{Address: 1, Function: FunctionWriteControl, Data: []byte{ControlRun}}); rsp.Data[0] != 0x80 || vfd.Rpm() != 0 {
+		t.Error("Tripped VFD has to stop")
+	}
+	if _, ok := vfd.Handle(TFrame{Address: 2, Function: FunctionReadControl, Data: []byte{ReadRpm}}); ok {
+		t.Error("Foreign address answered")
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (C) 2018 Sebastian Schleemilch
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+
+// Package hysim simulates a Huanyang VFD speaking its Modbus RTU like
+// protocol. The simulator models the acceleration of the spindle and
+// fault conditions, so the spindle integration can be tested without
+// an inverter. On Linux it can be served on a pseudo-terminal, which is
+// opened by the VFD library like a real serial port.
+package hysim